@@ -0,0 +1,118 @@
+package governance
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Removal is implemented by deltas which take away access or delete
+// something.
+type Removal interface {
+	// RemovalSubject identifies the member affected, e.g. a user ID or login.
+	// Several removals may share the same subject. Removals which don't affect
+	// a member, e.g. deleting a channel, return "" and count only towards
+	// MaxRemovals.
+	RemovalSubject() string
+}
+
+// MultiRemoval is implemented by removal deltas which affect several subjects
+// at once, e.g. deleting a role along with everyone's membership in it. Each
+// subject counts as a removal of its own; with no subjects, it counts once.
+type MultiRemoval interface {
+	RemovalSubjects() []string
+}
+
+// Populated is implemented by provider states which know how many members
+// they cover, so that removals can be limited to a share of them.
+type Populated interface {
+	Population() int
+}
+
+// BlastRadius limits how much a single run is allowed to remove, to guard
+// against a bad config change, e.g. flipping all_contributors or emptying a
+// team's member list. Zero values disable the corresponding limit.
+type BlastRadius struct {
+	// MaxRemovals is the most removals allowed per provider, counting each
+	// subject of a MultiRemoval.
+	MaxRemovals int
+
+	// MaxPercent is the largest share of the population, from 0 to 100,
+	// allowed to be affected by removals. Only removals with a subject count.
+	MaxPercent float64
+}
+
+// BlastRadiusError is returned when a plan exceeds the BlastRadius.
+type BlastRadiusError struct {
+	Provider string
+	Reason   string
+	Removals []ProviderDelta
+}
+
+func (err BlastRadiusError) Error() string {
+	return fmt.Sprintf("%s: refusing to apply %d removals: %s", err.Provider, len(err.Removals), err.Reason)
+}
+
+// Deltas describes each offending delta on its own line.
+func (err BlastRadiusError) Deltas() string {
+	lines := make([]string, len(err.Removals))
+	for i, removal := range err.Removals {
+		lines[i] = fmt.Sprintf("%T %+v", removal, removal)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Check returns a BlastRadiusError if the plan removes too much.
+func (guard BlastRadius) Check(plan ProviderPlan) error {
+	var removals []ProviderDelta
+	var count int
+	subjects := map[string]bool{}
+	for _, delta := range plan.Deltas {
+		var affected []string
+		switch removal := delta.(type) {
+		case MultiRemoval:
+			affected = removal.RemovalSubjects()
+		case Removal:
+			affected = []string{removal.RemovalSubject()}
+		default:
+			continue
+		}
+
+		removals = append(removals, delta)
+		if len(affected) == 0 {
+			count++
+		}
+
+		for _, subject := range affected {
+			count++
+			if subject != "" {
+				subjects[subject] = true
+			}
+		}
+	}
+
+	if len(removals) == 0 {
+		return nil
+	}
+
+	fail := func(reason string, args ...interface{}) error {
+		return BlastRadiusError{
+			Provider: plan.Provider.Name(),
+			Reason:   fmt.Sprintf(reason, args...),
+			Removals: removals,
+		}
+	}
+
+	if guard.MaxRemovals > 0 && count > guard.MaxRemovals {
+		return fail("more than %d removals", guard.MaxRemovals)
+	}
+
+	if guard.MaxPercent > 0 && plan.Population > 0 {
+		percent := float64(len(subjects)) / float64(plan.Population) * 100
+		if percent > guard.MaxPercent {
+			return fail("%.1f%% of %d affected, more than %.1f%%", percent, plan.Population, guard.MaxPercent)
+		}
+	}
+
+	return nil
+}
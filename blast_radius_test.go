@@ -0,0 +1,135 @@
+package governance_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRemoval struct {
+	User string
+	Role string
+}
+
+func (removal fakeRemoval) RemovalSubject() string { return removal.User }
+
+type fakeMultiRemoval []string
+
+func (removal fakeMultiRemoval) RemovalSubjects() []string { return removal }
+
+func TestBlastRadius(t *testing.T) {
+	provider := &fakeProvider{name: "fake"}
+
+	plan := governance.ProviderPlan{
+		Provider: provider,
+		Deltas: []governance.ProviderDelta{
+			"not a removal",
+			fakeRemoval{User: "alice", Role: "a"},
+			fakeRemoval{User: "alice", Role: "b"},
+			fakeRemoval{User: "bob", Role: "a"},
+		},
+		Population: 10,
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		guard := governance.BlastRadius{MaxRemovals: 3, MaxPercent: 20}
+		require.NoError(t, guard.Check(plan))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, governance.BlastRadius{}.Check(plan))
+	})
+
+	t.Run("too many removals", func(t *testing.T) {
+		guard := governance.BlastRadius{MaxRemovals: 2}
+
+		err := guard.Check(plan)
+		require.Equal(t, governance.BlastRadiusError{
+			Provider: "fake",
+			Reason:   "more than 2 removals",
+			Removals: plan.Deltas[1:],
+		}, err)
+		require.EqualError(t, err, "fake: refusing to apply 3 removals: more than 2 removals")
+		require.Equal(t, ""+
+			"governance_test.fakeRemoval {User:alice Role:a}\n"+
+			"governance_test.fakeRemoval {User:alice Role:b}\n"+
+			"governance_test.fakeRemoval {User:bob Role:a}",
+			err.(governance.BlastRadiusError).Deltas())
+	})
+
+	t.Run("too many members affected", func(t *testing.T) {
+		guard := governance.BlastRadius{MaxPercent: 15}
+
+		err := guard.Check(plan)
+		require.EqualError(t, err, "fake: refusing to apply 3 removals: 20.0% of 10 affected, more than 15.0%")
+	})
+
+	t.Run("counts each subject of a multi removal", func(t *testing.T) {
+		multi := governance.ProviderPlan{
+			Provider:   provider,
+			Deltas:     []governance.ProviderDelta{fakeMultiRemoval{"alice", "bob", "carol"}},
+			Population: 10,
+		}
+
+		err := governance.BlastRadius{MaxRemovals: 2}.Check(multi)
+		require.EqualError(t, err, "fake: refusing to apply 1 removals: more than 2 removals")
+
+		err = governance.BlastRadius{MaxPercent: 25}.Check(multi)
+		require.EqualError(t, err, "fake: refusing to apply 1 removals: 30.0% of 10 affected, more than 25.0%")
+
+		require.NoError(t, governance.BlastRadius{MaxRemovals: 3, MaxPercent: 30}.Check(multi))
+	})
+
+	t.Run("counts removals without a subject only towards the limit", func(t *testing.T) {
+		unpopulated := governance.ProviderPlan{
+			Provider: provider,
+			Deltas: []governance.ProviderDelta{
+				fakeRemoval{Role: "a"},
+				fakeRemoval{Role: "b"},
+				fakeMultiRemoval{},
+			},
+			Population: 10,
+		}
+
+		require.NoError(t, governance.BlastRadius{MaxPercent: 5}.Check(unpopulated))
+
+		err := governance.BlastRadius{MaxRemovals: 2}.Check(unpopulated)
+		require.EqualError(t, err, "fake: refusing to apply 3 removals: more than 2 removals")
+	})
+
+	t.Run("unknown population", func(t *testing.T) {
+		guard := governance.BlastRadius{MaxPercent: 15}
+
+		unknown := plan
+		unknown.Population = 0
+		require.NoError(t, guard.Check(unknown))
+	})
+}
+
+func TestRunnerBlastRadius(t *testing.T) {
+	var events []string
+
+	runner := governance.Runner{
+		Providers: []governance.Provider{
+			&fakeProvider{name: "first", actual: []string{}, events: &events},
+		},
+		BlastRadius: governance.BlastRadius{MaxRemovals: 1},
+	}
+
+	plans, err := runner.Plan(context.Background(), &governance.Config{})
+	require.NoError(t, err)
+
+	plans[0].Deltas = []governance.ProviderDelta{
+		fakeRemoval{User: "alice"},
+		fakeRemoval{User: "bob"},
+	}
+
+	err = runner.Apply(context.Background(), plans)
+
+	var blastErr governance.BlastRadiusError
+	require.True(t, errors.As(err, &blastErr))
+	require.Equal(t, []string{"first: load"}, events)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/concourse/governance"
+)
+
+// exit status used when drift is detected, to distinguish it from failing to
+// produce a report at all
+const driftExitCode = 2
+
+func main() {
+	org := flag.String("org", "concourse", "GitHub organization to check")
+	domain := flag.String("domain", "concourse-ci.org", "Mailgun domain to check")
+	jsonPath := flag.String("json", "", "write the JSON report to this path")
+	markdownPath := flag.String("markdown", "", "write the Markdown summary to this path instead of stdout")
+	flag.Parse()
+
+	config, err := governance.LoadConfig(os.DirFS("."))
+	if err != nil {
+		log.Fatalln("failed to load config:", err)
+	}
+
+	ghState, err := governance.LoadGitHubState(*org)
+	if err != nil {
+		log.Fatalln("failed to load GitHub state:", err)
+	}
+
+	mgState, err := governance.LoadMailgunState(*domain)
+	if err != nil {
+		log.Fatalln("failed to load Mailgun state:", err)
+	}
+
+	report := NewReport(
+		*org,
+		*domain,
+		governance.DiffGitHub(config.DesiredGitHubState(), *ghState),
+		governance.DiffMailgun(*config.DesiredMailgunState(*domain), *mgState),
+	)
+
+	if *jsonPath != "" {
+		file, err := os.Create(*jsonPath)
+		if err != nil {
+			log.Fatalln("failed to create JSON report:", err)
+		}
+
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(report)
+		if err != nil {
+			log.Fatalln("failed to write JSON report:", err)
+		}
+
+		err = file.Close()
+		if err != nil {
+			log.Fatalln("failed to write JSON report:", err)
+		}
+	}
+
+	markdown := os.Stdout
+	if *markdownPath != "" {
+		markdown, err = os.Create(*markdownPath)
+		if err != nil {
+			log.Fatalln("failed to create Markdown summary:", err)
+		}
+	}
+
+	err = report.WriteMarkdown(markdown)
+	if err != nil {
+		log.Fatalln("failed to write Markdown summary:", err)
+	}
+
+	// only close what we opened, not stdout
+	if *markdownPath != "" {
+		err = markdown.Close()
+		if err != nil {
+			log.Fatalln("failed to write Markdown summary:", err)
+		}
+	}
+
+	if report.Drift {
+		os.Exit(driftExitCode)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/concourse/governance"
+)
+
+// Report is the machine-readable drift report.
+type Report struct {
+	Organization string  `json:"organization"`
+	Domain       string  `json:"domain"`
+	Drift        bool    `json:"drift"`
+	Groups       []Group `json:"groups"`
+}
+
+// Group collects the changes for a single organization, team, repo, or mail
+// route.
+type Group struct {
+	Kind    string  `json:"kind"`
+	Name    string  `json:"name"`
+	Changes []Entry `json:"changes"`
+}
+
+type Entry struct {
+	Type    string      `json:"type"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details"`
+}
+
+const kindMailRoute = "mail_route"
+
+var kindOrder = map[string]int{
+	string(governance.GitHubTargetOrganization): 0,
+	string(governance.GitHubTargetTeam):         1,
+	string(governance.GitHubTargetRepo):         2,
+	kindMailRoute:                               3,
+}
+
+var kindTitles = map[string]string{
+	string(governance.GitHubTargetOrganization): "Organization",
+	string(governance.GitHubTargetTeam):         "Team",
+	string(governance.GitHubTargetRepo):         "Repo",
+	kindMailRoute:                               "Mail route",
+}
+
+func NewReport(org, domain string, githubChanges []governance.GitHubChange, mailgunChanges []governance.MailgunChange) Report {
+	report := Report{
+		Organization: org,
+		Domain:       domain,
+		Drift:        len(githubChanges) > 0 || len(mailgunChanges) > 0,
+		Groups:       []Group{},
+	}
+
+	groups := map[[2]string]*Group{}
+	add := func(kind, name string, change interface{ String() string }) {
+		key := [2]string{kind, name}
+
+		group, found := groups[key]
+		if !found {
+			group = &Group{Kind: kind, Name: name}
+			groups[key] = group
+		}
+
+		group.Changes = append(group.Changes, Entry{
+			Type:    reflect.TypeOf(change).Name(),
+			Message: change.String(),
+			Details: change,
+		})
+	}
+
+	for _, change := range githubChanges {
+		target := change.Target()
+
+		name := target.Name
+		if target.Kind == governance.GitHubTargetOrganization {
+			name = org
+		}
+
+		add(string(target.Kind), name, change)
+	}
+
+	for _, change := range mailgunChanges {
+		add(kindMailRoute, change.Route(), change)
+	}
+
+	for _, group := range groups {
+		report.Groups = append(report.Groups, *group)
+	}
+
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Kind != b.Kind {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+
+		return a.Name < b.Name
+	})
+
+	return report
+}
+
+// WriteMarkdown renders a human-readable summary of the report.
+func (report Report) WriteMarkdown(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# Drift report for %s\n\n", report.Organization)
+	if err != nil {
+		return err
+	}
+
+	if !report.Drift {
+		_, err := fmt.Fprintln(w, "No drift detected.")
+		return err
+	}
+
+	var total int
+	for _, group := range report.Groups {
+		total += len(group.Changes)
+	}
+
+	_, err = fmt.Fprintf(w, "Found %d change(s) across %d object(s).\n", total, len(report.Groups))
+	if err != nil {
+		return err
+	}
+
+	for _, group := range report.Groups {
+		_, err := fmt.Fprintf(w, "\n## %s `%s`\n\n", kindTitles[group.Kind], group.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range group.Changes {
+			_, err := fmt.Fprintf(w, "* %s\n", entry.Message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	report := NewReport(
+		"concourse",
+		"concourse-ci.org",
+		[]governance.GitHubChange{
+			governance.GitHubMemberUnexpected{Login: "mallory", Role: governance.OrgRoleAdmin},
+			governance.GitHubTeamMemberMissing{Team: "core", Login: "alice", Role: governance.TeamRoleMember},
+			governance.GitHubRepoUnexpected{Repo: "stray"},
+			governance.GitHubCollaboratorUnexpected{Repo: "concourse", Login: "mallory", Permission: governance.RepoPermissionAdmin},
+		},
+		[]governance.MailgunChange{
+			governance.MailgunRouteMissing{Description: `mailgun_route.routes["core"]`},
+		},
+	)
+
+	require.True(t, report.Drift)
+
+	var md bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&md))
+	require.Equal(t, `# Drift report for concourse
+
+Found 5 change(s) across 5 object(s).
+
+## Organization `+"`concourse`"+`
+
+* mallory should not be a member (role ADMIN)
+
+## Team `+"`core`"+`
+
+* alice should be a member of the core team, but is not
+
+## Repo `+"`concourse`"+`
+
+* mallory should not be a collaborator (has ADMIN access)
+
+## Repo `+"`stray`"+`
+
+* repo is not in configuration
+
+## Mail route `+"`mailgun_route.routes[\"core\"]`"+`
+
+* route is not configured
+`, md.String())
+
+	payload, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &decoded))
+
+	groups := decoded["groups"].([]interface{})
+	require.Len(t, groups, 5)
+	require.Equal(t, map[string]interface{}{
+		"kind": "organization",
+		"name": "concourse",
+		"changes": []interface{}{
+			map[string]interface{}{
+				"type":    "GitHubMemberUnexpected",
+				"message": "mallory should not be a member (role ADMIN)",
+				"details": map[string]interface{}{
+					"Login": "mallory",
+					"Role":  "ADMIN",
+				},
+			},
+		},
+	}, groups[0])
+}
+
+func TestReportNoDrift(t *testing.T) {
+	report := NewReport("concourse", "concourse-ci.org", nil, nil)
+	require.False(t, report.Drift)
+
+	var md bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&md))
+	require.Equal(t, "# Drift report for concourse\n\nNo drift detected.\n", md.String())
+}
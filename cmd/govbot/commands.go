@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/concourse/governance"
+)
+
+// application command option types, from
+// https://discord.com/developers/docs/interactions/application-commands
+const (
+	optionString = 3
+	optionUser   = 6
+)
+
+type command struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Options     []commandOption `json:"options"`
+}
+
+type commandOption struct {
+	Type        int    `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// commands are registered with Discord by running with -register.
+var commands = []command{
+	{
+		Name:        "team",
+		Description: "Show a team's purpose, members, and repos",
+		Options: []commandOption{
+			{Type: optionString, Name: "name", Description: "Team name, e.g. core", Required: true},
+		},
+	},
+	{
+		Name:        "whois",
+		Description: "Show who a Discord user is on GitHub and which teams they're on",
+		Options: []commandOption{
+			{Type: optionUser, Name: "user", Description: "Discord user", Required: true},
+		},
+	},
+	{
+		Name:        "owners",
+		Description: "Show which teams own a repo",
+		Options: []commandOption{
+			{Type: optionString, Name: "repo", Description: "Repo name, e.g. concourse", Required: true},
+		},
+	},
+}
+
+// answer responds to a slash command with a message.
+func answer(config *governance.Config, data interactionData) string {
+	option := func(name string) string {
+		for _, opt := range data.Options {
+			if opt.Name == name {
+				return opt.Value
+			}
+		}
+
+		return ""
+	}
+
+	switch data.Name {
+	case "team":
+		return answerTeam(config, option("name"))
+	case "whois":
+		user, found := data.Resolved.Users[option("user")]
+		if !found {
+			user = interactionUser{ID: option("user")}
+		}
+
+		return answerWhois(config, user)
+	case "owners":
+		return answerOwners(config, option("repo"))
+	default:
+		return fmt.Sprintf("Unknown command: %s", data.Name)
+	}
+}
+
+func answerTeam(config *governance.Config, name string) string {
+	team, found := findTeam(config, name)
+	if !found {
+		return fmt.Sprintf("No team named %q.", name)
+	}
+
+	var members []string
+	for login, person := range team.Members(config) {
+		member := fmt.Sprintf("%s (%s)", person.Name, login)
+		if team.MemberRole(login) == governance.TeamRoleMaintainer {
+			member += " - maintainer"
+		}
+
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "**%s**: %s\n", team.Name, strings.TrimSpace(team.Purpose))
+
+	if team.AllContributors {
+		fmt.Fprintf(&msg, "\nMembers: all %d contributors\n", len(members))
+	} else {
+		fmt.Fprintf(&msg, "\nMembers:\n")
+		for _, member := range members {
+			fmt.Fprintf(&msg, "- %s\n", member)
+		}
+	}
+
+	if len(team.Repos) > 0 {
+		fmt.Fprintf(&msg, "\nRepos: %s\n", strings.Join(team.Repos, ", "))
+	}
+
+	return msg.String()
+}
+
+func answerWhois(config *governance.Config, user interactionUser) string {
+	login, person, found := findContributor(config, user)
+	if !found {
+		return fmt.Sprintf("<@%s> isn't linked to a contributor.", user.ID)
+	}
+
+	var teams []string
+	for _, team := range config.Teams {
+		if _, member := team.Members(config)[login]; member && !team.AllContributors {
+			teams = append(teams, team.Name)
+		}
+	}
+
+	sort.Strings(teams)
+
+	msg := fmt.Sprintf("<@%s> is **%s**, `%s` on GitHub.", user.ID, person.Name, person.GitHub)
+	if len(teams) > 0 {
+		msg += fmt.Sprintf(" Teams: %s.", strings.Join(teams, ", "))
+	}
+
+	return msg
+}
+
+func answerOwners(config *governance.Config, name string) string {
+	if _, found := config.Repos[name]; !found {
+		return fmt.Sprintf("No repo named %q.", name)
+	}
+
+	var teams []string
+	for _, team := range config.Teams {
+		for _, repo := range team.Repos {
+			if repo == name {
+				teams = append(teams, fmt.Sprintf("**%s** (%s)", team.Name, strings.ToLower(string(team.RepoPermission()))))
+			}
+		}
+	}
+
+	sort.Strings(teams)
+
+	var collaborators []string
+	for login, person := range config.Contributors {
+		if permission, found := person.Repos[name]; found {
+			collaborators = append(collaborators, fmt.Sprintf("%s (%s)", login, permission))
+		}
+	}
+
+	sort.Strings(collaborators)
+
+	if len(teams) == 0 && len(collaborators) == 0 {
+		return fmt.Sprintf("`%s` isn't owned by any team.", name)
+	}
+
+	var lines []string
+	if len(teams) > 0 {
+		lines = append(lines, fmt.Sprintf("`%s` is owned by %s.", name, strings.Join(teams, ", ")))
+	}
+
+	if len(collaborators) > 0 {
+		lines = append(lines, fmt.Sprintf("Collaborators: %s.", strings.Join(collaborators, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// findTeam finds a team by its file name or its name, ignoring case.
+func findTeam(config *governance.Config, name string) (governance.Team, bool) {
+	if team, found := config.Teams[name]; found {
+		return team, true
+	}
+
+	for _, team := range config.Teams {
+		if strings.EqualFold(team.Name, name) {
+			return team, true
+		}
+	}
+
+	return governance.Team{}, false
+}
+
+// findContributor matches the user the same way harmonize does: by ID,
+// username, or legacy name#1234 tag.
+func findContributor(config *governance.Config, user interactionUser) (string, governance.Person, bool) {
+	handles := map[string]bool{
+		user.ID:                        true,
+		strings.ToLower(user.Username): true,
+	}
+
+	if user.Discriminator != "" && user.Discriminator != "0" {
+		handles[user.Username+"#"+user.Discriminator] = true
+	}
+
+	for login, person := range config.Contributors {
+		if person.Discord == "" {
+			continue
+		}
+
+		if handles[person.Discord] || handles[strings.ToLower(person.Discord)] {
+			return login, person, true
+		}
+	}
+
+	return "", governance.Person{}, false
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/concourse/governance"
+)
+
+// maxBodySize is far more than any interaction needs.
+const maxBodySize = 1 << 20
+
+// maxSkew is how far a request's timestamp may be from the current time, so
+// that a captured request can't be replayed later.
+const maxSkew = 5 * time.Minute
+
+// interaction and response types, from
+// https://discord.com/developers/docs/interactions/receiving-and-responding
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+
+	responsePong    = 1
+	responseMessage = 4
+)
+
+type interaction struct {
+	Type int             `json:"type"`
+	Data interactionData `json:"data"`
+}
+
+type interactionData struct {
+	Name     string              `json:"name"`
+	Options  []interactionOption `json:"options"`
+	Resolved struct {
+		Users map[string]interactionUser `json:"users"`
+	} `json:"resolved"`
+}
+
+type interactionOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type interactionUser struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+}
+
+type response struct {
+	Type int           `json:"type"`
+	Data *responseData `json:"data,omitempty"`
+}
+
+type responseData struct {
+	Content         string          `json:"content"`
+	AllowedMentions allowedMentions `json:"allowed_mentions"`
+}
+
+// allowedMentions is always empty so that answers never ping anyone.
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// Handler serves Discord interactions, answering slash commands from the
+// config.
+type Handler struct {
+	// PublicKey is the application's key, used to verify that requests came
+	// from Discord.
+	PublicKey ed25519.PublicKey
+
+	Config *governance.Config
+
+	// Now returns the current time, for checking request timestamps.
+	// Defaults to time.Now.
+	Now func() time.Time
+}
+
+func (handler Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !handler.verify(r.Header, body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var req interaction
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, "malformed interaction", http.StatusBadRequest)
+		return
+	}
+
+	var res response
+	switch req.Type {
+	case interactionPing:
+		res = response{Type: responsePong}
+	case interactionCommand:
+		res = response{
+			Type: responseMessage,
+			Data: &responseData{
+				Content:         answer(handler.Config, req.Data),
+				AllowedMentions: allowedMentions{Parse: []string{}},
+			},
+		}
+	default:
+		http.Error(w, "unsupported interaction type", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Println("failed to write response:", err)
+	}
+}
+
+// verify checks the signature Discord sends over the timestamp and body, and
+// that the timestamp is recent.
+func (handler Handler) verify(header http.Header, body []byte) bool {
+	signature, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+
+	timestamp := header.Get("X-Signature-Timestamp")
+	if timestamp == "" {
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now
+	if handler.Now != nil {
+		now = handler.Now
+	}
+
+	skew := now().Sub(time.Unix(seconds, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return false
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString(timestamp)
+	msg.Write(body)
+
+	return ed25519.Verify(handler.PublicKey, msg.Bytes(), signature)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/concourse/governance"
+	"github.com/stretchr/testify/require"
+)
+
+var config = &governance.Config{
+	Contributors: map[string]governance.Person{
+		"alice": {
+			Name:    "Alice",
+			GitHub:  "alice",
+			Discord: "alice",
+		},
+		"bob": {
+			Name:    "Bob",
+			GitHub:  "bob",
+			Discord: "bob#1234",
+		},
+		"ci-bot": {
+			Name:   "CI Bot",
+			GitHub: "ci-bot",
+			Repos: map[string]string{
+				"concourse-chart": "push",
+			},
+		},
+	},
+	Teams: map[string]governance.Team{
+		"security": {
+			Name:           "security",
+			Purpose:        "Keep things secure.\n",
+			RawMembers:     []string{"alice", "bob"},
+			RawMaintainers: []string{"alice"},
+			Repos:          []string{"concourse"},
+		},
+		"k8s": {
+			Name:              "k8s",
+			Purpose:           "Kubernetes things.",
+			RawMembers:        []string{"bob"},
+			RawRepoPermission: "push",
+			Repos:             []string{"concourse-chart"},
+		},
+	},
+	Repos: map[string]governance.Repo{
+		"concourse":       {Name: "concourse"},
+		"concourse-chart": {Name: "concourse-chart"},
+	},
+}
+
+// fixed so that the signed requests are the same on every run
+var privateKey = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+
+func TestInteractions(t *testing.T) {
+	for name, expected := range map[string]string{
+		"team.json": "**security**: Keep things secure.\n" +
+			"\nMembers:\n" +
+			"- Alice (alice) - maintainer\n" +
+			"- Bob (bob)\n" +
+			"\nRepos: concourse\n",
+		"whois.json": "<@111222333> is **Alice**, `alice` on GitHub. Teams: security.",
+		"owners.json": "`concourse-chart` is owned by **k8s** (write).\n" +
+			"Collaborators: ci-bot (push).",
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := serve(t, signed(t, name))
+			require.Equal(t, http.StatusOK, res.Code)
+
+			var body struct {
+				Type int `json:"type"`
+				Data struct {
+					Content         string `json:"content"`
+					AllowedMentions struct {
+						Parse []string `json:"parse"`
+					} `json:"allowed_mentions"`
+				} `json:"data"`
+			}
+			err := json.Unmarshal(res.Body.Bytes(), &body)
+			require.NoError(t, err)
+			require.Equal(t, 4, body.Type)
+			require.Equal(t, expected, body.Data.Content)
+			require.NotNil(t, body.Data.AllowedMentions.Parse)
+			require.Empty(t, body.Data.AllowedMentions.Parse)
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	res := serve(t, signed(t, "ping.json"))
+	require.Equal(t, http.StatusOK, res.Code)
+	require.JSONEq(t, `{"type":1}`, res.Body.String())
+}
+
+func TestSignature(t *testing.T) {
+	req := signed(t, "ping.json")
+	req.Header.Set("X-Signature-Timestamp", "1700000001")
+	require.Equal(t, http.StatusUnauthorized, serve(t, req).Code)
+
+	req = signed(t, "ping.json")
+	req.Header.Set("X-Signature-Ed25519", "not-hex")
+	require.Equal(t, http.StatusUnauthorized, serve(t, req).Code)
+
+	req = signed(t, "ping.json")
+	req.Header.Del("X-Signature-Timestamp")
+	require.Equal(t, http.StatusUnauthorized, serve(t, req).Code)
+
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	body := fixture(t, "ping.json")
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature-Timestamp", "1700000000")
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(otherKey, append([]byte("1700000000"), body...))))
+	require.Equal(t, http.StatusUnauthorized, serve(t, req).Code)
+}
+
+func TestUnknown(t *testing.T) {
+	require.Equal(t, `No team named "bogus".`, answerTeam(config, "bogus"))
+	require.Equal(t, `No repo named "bogus".`, answerOwners(config, "bogus"))
+	require.Equal(t, "`concourse` is owned by **security** (maintain).", answerOwners(config, "concourse"))
+	require.Equal(t, "<@999> isn't linked to a contributor.", answerWhois(config, interactionUser{ID: "999", Username: "mallory"}))
+	require.Equal(t, "<@888> is **Bob**, `bob` on GitHub. Teams: k8s, security.", answerWhois(config, interactionUser{ID: "888", Username: "bob", Discriminator: "1234"}))
+}
+
+func TestTimestamp(t *testing.T) {
+	signedAt := time.Unix(1700000000, 0)
+
+	for _, offset := range []time.Duration{-6 * time.Minute, 6 * time.Minute, time.Hour} {
+		res := serveAt(t, signed(t, "ping.json"), signedAt.Add(offset))
+		require.Equal(t, http.StatusUnauthorized, res.Code, "offset %s", offset)
+	}
+
+	res := serveAt(t, signed(t, "ping.json"), signedAt.Add(4*time.Minute))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	req := signed(t, "ping.json")
+	req.Header.Set("X-Signature-Timestamp", "yesterday")
+	require.Equal(t, http.StatusUnauthorized, serve(t, req).Code)
+}
+
+func TestBodyLimit(t *testing.T) {
+	body := bytes.Repeat([]byte(" "), maxBodySize+1)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	require.Equal(t, http.StatusBadRequest, serve(t, req).Code)
+}
+
+func serve(t *testing.T, req *http.Request) *httptest.ResponseRecorder {
+	// the time the fixtures were signed at
+	return serveAt(t, req, time.Unix(1700000000, 0))
+}
+
+func serveAt(t *testing.T, req *http.Request, now time.Time) *httptest.ResponseRecorder {
+	handler := Handler{
+		PublicKey: privateKey.Public().(ed25519.PublicKey),
+		Config:    config,
+		Now:       func() time.Time { return now },
+	}
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	return res
+}
+
+func fixture(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	return body
+}
+
+// signed builds a request for the fixture, signed the way Discord signs them.
+func signed(t *testing.T, name string) *http.Request {
+	body := fixture(t, name)
+
+	timestamp := "1700000000"
+	signature := ed25519.Sign(privateKey, append([]byte(timestamp), body...))
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+
+	return req
+}
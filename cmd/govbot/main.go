@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/concourse/governance"
+)
+
+// Concourse Discord server ID
+const guildID = "219899946617274369"
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve interactions on")
+	register := flag.Bool("register", false, "register the slash commands with Discord and exit")
+	flag.Parse()
+
+	if *register {
+		err := registerCommands(os.Getenv("DISCORD_APPLICATION_ID"), os.Getenv("DISCORD_TOKEN"))
+		if err != nil {
+			log.Fatalln("failed to register commands:", err)
+		}
+
+		return
+	}
+
+	publicKey, err := hex.DecodeString(os.Getenv("DISCORD_PUBLIC_KEY"))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		log.Fatalln("$DISCORD_PUBLIC_KEY must be the application's hex-encoded public key")
+	}
+
+	config, err := governance.LoadConfig(os.DirFS("."))
+	if err != nil {
+		log.Fatalln("failed to load config:", err)
+	}
+
+	handler := Handler{
+		PublicKey: publicKey,
+		Config:    config,
+	}
+
+	log.Println("serving interactions on", *addr)
+
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  time.Minute,
+	}
+
+	err = server.ListenAndServe()
+	if err != nil {
+		log.Fatalln("failed to serve:", err)
+	}
+}
+
+// registerCommands replaces the server's commands with the current set.
+func registerCommands(applicationID, token string) error {
+	if applicationID == "" || token == "" {
+		return fmt.Errorf("$DISCORD_APPLICATION_ID and $DISCORD_TOKEN must be set")
+	}
+
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return fmt.Errorf("init discordgo: %w", err)
+	}
+
+	endpoint := discordgo.EndpointAPI + "applications/" + applicationID + "/guilds/" + guildID + "/commands"
+
+	_, err = session.RequestWithBucketID("PUT", endpoint, commands, endpoint)
+	if err != nil {
+		return fmt.Errorf("put commands: %w", err)
+	}
+
+	return nil
+}
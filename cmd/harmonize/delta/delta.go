@@ -3,6 +3,7 @@ package delta
 import (
 	"fmt"
 
+	"github.com/concourse/governance"
 	"go.uber.org/zap"
 )
 
@@ -14,22 +15,35 @@ type DeltaRoleCreate struct {
 	RoleName    string
 	Color       int
 	Permissions int64
+	Hoist       bool
+	Mentionable bool
+	Emoji       string
 }
 
 func (delta DeltaRoleCreate) Apply(logger *zap.Logger, discord Discord) error {
 	logger.Info("creating role",
 		zap.String("name", delta.RoleName),
 		zap.String("color", fmt.Sprintf("%06x", delta.Color)),
-		zap.Int64("permissions", delta.Permissions))
+		zap.Strings("permissions", governance.DiscordPermissionNames(delta.Permissions)),
+		zap.Bool("hoist", delta.Hoist),
+		zap.Bool("mentionable", delta.Mentionable),
+		zap.String("emoji", delta.Emoji))
 
 	return discord.CreateRole(delta)
 }
 
+func (delta DeltaRoleCreate) Provides() []string  { return []string{roleKey(delta.RoleName)} }
+func (delta DeltaRoleCreate) DependsOn() []string { return nil }
+
 type DeltaRoleEdit struct {
 	RoleID      string
 	RoleName    string
+	OldName     string
 	Color       int
 	Permissions int64
+	Hoist       bool
+	Mentionable bool
+	Emoji       string
 }
 
 func (delta DeltaRoleEdit) Apply(logger *zap.Logger, discord Discord) error {
@@ -37,11 +51,49 @@ func (delta DeltaRoleEdit) Apply(logger *zap.Logger, discord Discord) error {
 		zap.String("id", delta.RoleID),
 		zap.String("name", delta.RoleName),
 		zap.String("color", fmt.Sprintf("%06x", delta.Color)),
-		zap.Int64("permissions", delta.Permissions))
+		zap.Strings("permissions", governance.DiscordPermissionNames(delta.Permissions)),
+		zap.Bool("hoist", delta.Hoist),
+		zap.Bool("mentionable", delta.Mentionable),
+		zap.String("emoji", delta.Emoji))
 
 	return discord.EditRole(delta)
 }
 
+// Provides the role's new name when the edit renames it.
+func (delta DeltaRoleEdit) Provides() []string {
+	if delta.RoleName == delta.OldName {
+		return nil
+	}
+
+	return []string{roleKey(delta.RoleName)}
+}
+
+func (delta DeltaRoleEdit) DependsOn() []string { return nil }
+
+type DeltaRoleDelete struct {
+	RoleID   string
+	RoleName string
+
+	// IDs of the members who hold the role, each of whom loses it
+	Holders []string
+}
+
+func (delta DeltaRoleDelete) Apply(logger *zap.Logger, discord Discord) error {
+	logger.Info("deleting role",
+		zap.String("id", delta.RoleID),
+		zap.String("name", delta.RoleName),
+		zap.Int("holders", len(delta.Holders)))
+
+	return discord.DeleteRole(delta)
+}
+
+func (delta DeltaRoleDelete) RemovalSubjects() []string {
+	return delta.Holders
+}
+
+func (delta DeltaRoleDelete) Provides() []string  { return nil }
+func (delta DeltaRoleDelete) DependsOn() []string { return nil }
+
 type DeltaRolePositions []string
 
 func (delta DeltaRolePositions) Apply(logger *zap.Logger, discord Discord) error {
@@ -51,6 +103,97 @@ func (delta DeltaRolePositions) Apply(logger *zap.Logger, discord Discord) error
 	return discord.SetRolePositions(delta)
 }
 
+func (delta DeltaRolePositions) Provides() []string { return nil }
+
+func (delta DeltaRolePositions) DependsOn() []string {
+	keys := make([]string, len(delta))
+	for i, name := range delta {
+		keys[i] = roleKey(name)
+	}
+
+	return keys
+}
+
+type DeltaChannelCreate struct {
+	Name     string
+	Type     governance.DiscordChannelType
+	Topic    string
+	Category string
+
+	// RoleName is the only role allowed to see the channel.
+	RoleName string
+}
+
+func (delta DeltaChannelCreate) Apply(logger *zap.Logger, discord Discord) error {
+	logger.Info("creating channel",
+		zap.String("name", delta.Name),
+		zap.String("type", string(delta.Type)),
+		zap.String("category", delta.Category),
+		zap.String("role", delta.RoleName))
+
+	return discord.CreateChannel(delta)
+}
+
+func (delta DeltaChannelCreate) Provides() []string {
+	if delta.Type == governance.DiscordChannelCategory {
+		return []string{categoryKey(delta.Name)}
+	}
+
+	return nil
+}
+
+func (delta DeltaChannelCreate) DependsOn() []string {
+	return channelDependencies(delta.Category, delta.RoleName)
+}
+
+type DeltaChannelEdit struct {
+	ChannelID string
+	Name      string
+	Type      governance.DiscordChannelType
+	Topic     string
+	Category  string
+	RoleName  string
+}
+
+func (delta DeltaChannelEdit) Apply(logger *zap.Logger, discord Discord) error {
+	logger.Info("editing channel",
+		zap.String("id", delta.ChannelID),
+		zap.String("name", delta.Name),
+		zap.String("category", delta.Category),
+		zap.String("role", delta.RoleName))
+
+	return discord.EditChannel(delta)
+}
+
+func (delta DeltaChannelEdit) Provides() []string { return nil }
+
+func (delta DeltaChannelEdit) DependsOn() []string {
+	return channelDependencies(delta.Category, delta.RoleName)
+}
+
+// DeltaChannelDelete is never planned by a diff, only by a rollback of a run
+// which created the channel.
+type DeltaChannelDelete struct {
+	ChannelID string
+	Name      string
+}
+
+func (delta DeltaChannelDelete) Apply(logger *zap.Logger, discord Discord) error {
+	logger.Info("deleting channel",
+		zap.String("id", delta.ChannelID),
+		zap.String("name", delta.Name))
+
+	return discord.DeleteChannel(delta)
+}
+
+// RemovalSubject is empty, as no member is removed.
+func (delta DeltaChannelDelete) RemovalSubject() string {
+	return ""
+}
+
+func (delta DeltaChannelDelete) Provides() []string  { return nil }
+func (delta DeltaChannelDelete) DependsOn() []string { return nil }
+
 type DeltaUserAddRole struct {
 	UserID   string
 	UserName string
@@ -65,6 +208,13 @@ func (delta DeltaUserAddRole) Apply(logger *zap.Logger, discord Discord) error {
 	return discord.AddUserRole(delta)
 }
 
+func (delta DeltaUserAddRole) ConcurrencyKey() string {
+	return delta.UserID
+}
+
+func (delta DeltaUserAddRole) Provides() []string  { return nil }
+func (delta DeltaUserAddRole) DependsOn() []string { return []string{roleKey(delta.RoleName)} }
+
 type DeltaUserRemoveRole struct {
 	UserID   string
 	UserName string
@@ -78,3 +228,51 @@ func (delta DeltaUserRemoveRole) Apply(logger *zap.Logger, discord Discord) erro
 
 	return discord.RemoveUserRole(delta)
 }
+
+func (delta DeltaUserRemoveRole) RemovalSubject() string {
+	return delta.UserID
+}
+
+func (delta DeltaUserRemoveRole) ConcurrencyKey() string {
+	return delta.UserID
+}
+
+func (delta DeltaUserRemoveRole) Provides() []string  { return nil }
+func (delta DeltaUserRemoveRole) DependsOn() []string { return nil }
+
+type DeltaUserNickname struct {
+	UserID   string
+	UserName string
+	Nickname string
+}
+
+func (delta DeltaUserNickname) Apply(logger *zap.Logger, discord Discord) error {
+	logger.Info("setting nickname",
+		zap.String("user", delta.UserName),
+		zap.String("nickname", delta.Nickname))
+
+	return discord.SetNickname(delta)
+}
+
+func (delta DeltaUserNickname) ConcurrencyKey() string {
+	return delta.UserID
+}
+
+func (delta DeltaUserNickname) Provides() []string  { return nil }
+func (delta DeltaUserNickname) DependsOn() []string { return nil }
+
+// roleKey and categoryKey identify what deltas provide and depend on, as
+// governance.Dependent.
+func roleKey(name string) string     { return "role:" + name }
+func categoryKey(name string) string { return "category:" + name }
+
+// channelDependencies are the category a channel goes under, if any, and the
+// role allowed to see it.
+func channelDependencies(category, roleName string) []string {
+	keys := []string{roleKey(roleName)}
+	if category != "" {
+		keys = append(keys, categoryKey(category))
+	}
+
+	return keys
+}
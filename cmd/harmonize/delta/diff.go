@@ -3,27 +3,76 @@ package delta
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/concourse/governance"
 )
 
-func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
-	var deltas []Delta
+// State is a snapshot of the server's members, roles, and channels.
+type State struct {
+	Guild    DiscordGuild
+	Members  []DiscordMember
+	Roles    []DiscordRole
+	Channels []DiscordChannel
+}
+
+func (state State) Population() int {
+	return len(state.Members)
+}
+
+func LoadState(discord Discord) (State, error) {
+	guild, err := discord.Guild()
+	if err != nil {
+		return State{}, fmt.Errorf("get guild: %w", err)
+	}
 
 	members, err := discord.Members()
 	if err != nil {
-		return nil, fmt.Errorf("get members: %w", err)
+		return State{}, fmt.Errorf("get members: %w", err)
+	}
+
+	roles, err := discord.Roles()
+	if err != nil {
+		return State{}, fmt.Errorf("get roles: %w", err)
 	}
 
+	channels, err := discord.Channels()
+	if err != nil {
+		return State{}, fmt.Errorf("get channels: %w", err)
+	}
+
+	return State{
+		Guild:    guild,
+		Members:  members,
+		Roles:    roles,
+		Channels: channels,
+	}, nil
+}
+
+func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
+	state, err := LoadState(discord)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffState(config, state)
+}
+
+// DiffState computes the deltas necessary to bring a previously loaded state
+// in line with the config.
+func DiffState(config *governance.Config, state State) ([]Delta, error) {
+	var deltas []Delta
+
+	members := state.Members
+
 	userIDToName := map[string]string{}
-	nameToUserID := map[string]string{}
+	userIDs := indexMembers(members)
 
 	actualUserRoles := map[string]map[string]bool{}
 	desiredUserRoles := map[string]map[string]bool{}
 
 	for _, member := range members {
 		userIDToName[member.ID] = member.Name
-		nameToUserID[member.Name] = member.ID
 
 		actualRoles, found := actualUserRoles[member.ID]
 		if !found {
@@ -36,11 +85,8 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 		}
 	}
 
-	actualRoles, err := discord.Roles()
-	if err != nil {
-		return nil, fmt.Errorf("get members: %w", err)
-	}
-
+	// copy so sorting doesn't modify the caller's state
+	actualRoles := append([]DiscordRole{}, state.Roles...)
 	sort.Sort(byPosition(actualRoles))
 
 	roleIDToName := map[string]string{}
@@ -57,14 +103,22 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 
 	sort.Sort(byPriority(teams))
 
+	everyoneRoleID := ""
+	for _, role := range actualRoles {
+		if role.Name == everyoneRole {
+			everyoneRoleID = role.ID
+		}
+	}
+
+	var channelDeltas []Delta
+
 	roleOrder := make([]string, len(teams))
 	teamRoles := map[string]bool{}
 	stickyRoles := map[string]bool{}
+	managedRoles := map[string]bool{}
+	renamedRoles := map[string]string{}
 	for position, team := range teams {
-		roleName := team.Discord.Role
-		if roleName == "" {
-			roleName = team.Name + "-team"
-		}
+		roleName := teamRoleName(team)
 
 		roleOrder[position] = roleName
 		teamRoles[roleName] = true
@@ -73,13 +127,12 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 			stickyRoles[roleName] = true
 		}
 
-		var roleExists bool
-		var existingRole DiscordRole
-		for _, role := range actualRoles {
-			if role.Name == roleName {
-				roleExists = true
-				existingRole = role
-				break
+		existingRole, roleExists := findRole(actualRoles, team.Discord.RoleID, roleName)
+		if roleExists {
+			managedRoles[existingRole.ID] = true
+
+			if existingRole.Name != roleName {
+				renamedRoles[existingRole.Name] = roleName
 			}
 		}
 
@@ -93,28 +146,74 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 			return nil, err
 		}
 
+		// unset attributes default to the existing role's, or to true for new
+		// roles
+		hoist, mentionable := true, true
+		if roleExists {
+			hoist, mentionable = existingRole.Hoist, existingRole.Mentionable
+		}
+
+		if team.Discord.Hoist != nil {
+			hoist = *team.Discord.Hoist
+		}
+
+		if team.Discord.Mentionable != nil {
+			mentionable = *team.Discord.Mentionable
+		}
+
+		emoji := team.Discord.Emoji
+		if emoji == "" && roleExists {
+			emoji = existingRole.Emoji
+		}
+
+		desiredRole := DiscordRole{
+			ID:          existingRole.ID,
+			Name:        roleName,
+			Color:       team.Discord.Color,
+			Permissions: permissions,
+			Position:    existingRole.Position,
+			Hoist:       hoist,
+			Mentionable: mentionable,
+			Emoji:       emoji,
+		}
+
 		if !roleExists {
 			deltas = append(deltas, DeltaRoleCreate{
 				RoleName:    roleName,
 				Color:       team.Discord.Color,
 				Permissions: permissions,
+				Hoist:       hoist,
+				Mentionable: mentionable,
+				Emoji:       emoji,
 			})
-		} else if existingRole.Color != team.Discord.Color || existingRole.Permissions != permissions {
+		} else if existingRole != desiredRole {
 			deltas = append(deltas, DeltaRoleEdit{
 				RoleID:      existingRole.ID,
 				RoleName:    roleName,
+				OldName:     existingRole.Name,
 				Color:       team.Discord.Color,
 				Permissions: permissions,
+				Hoist:       hoist,
+				Mentionable: mentionable,
+				Emoji:       emoji,
 			})
 		}
 
+		roleID := ""
+		if roleExists {
+			roleID = existingRole.ID
+		}
+
+		channelDeltas = append(channelDeltas, diffChannels(team, roleName, roleID, everyoneRoleID, state.Channels)...)
+
 		for _, contributor := range team.Members(config) {
 			if contributor.Discord == "" {
 				continue
 			}
 
-			userID, found := nameToUserID[contributor.Discord]
+			userID, found := userIDs.resolve(contributor.Discord)
 			if !found {
+				// reported by Unresolved
 				continue
 			}
 
@@ -128,10 +227,29 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 		}
 	}
 
+	// members and positions refer to roles by name, so carry over any renames
+	for userID, roles := range actualUserRoles {
+		renamed := map[string]bool{}
+		for roleName := range roles {
+			if newName, found := renamedRoles[roleName]; found {
+				roleName = newName
+			}
+
+			renamed[roleName] = true
+		}
+
+		actualUserRoles[userID] = renamed
+	}
+
 	actualRoleOrder := []string{}
 	for _, role := range actualRoles {
-		if teamRoles[role.Name] {
-			actualRoleOrder = append(actualRoleOrder, role.Name)
+		roleName := role.Name
+		if newName, found := renamedRoles[roleName]; found {
+			roleName = newName
+		}
+
+		if teamRoles[roleName] {
+			actualRoleOrder = append(actualRoleOrder, roleName)
 		}
 	}
 
@@ -150,6 +268,9 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 		deltas = append(deltas, DeltaRolePositions(roleOrder))
 	}
 
+	// channels are granted to roles, so they come after the roles exist
+	deltas = append(deltas, channelDeltas...)
+
 	var addUserRoles []DeltaUserAddRole
 	for userID, desiredRoles := range desiredUserRoles {
 		actualRoles, found := actualUserRoles[userID]
@@ -214,9 +335,303 @@ func Diff(config *governance.Config, discord Discord) ([]Delta, error) {
 		deltas = append(deltas, v)
 	}
 
+	retiredRoles := map[string]bool{}
+	for _, role := range config.RetiredRoles {
+		retiredRoles[role.ID] = true
+	}
+
+	for _, role := range actualRoles {
+		if managedRoles[role.ID] || teamRoles[role.Name] {
+			continue
+		}
+
+		// only roles recorded as belonging to a removed team are deleted; any
+		// other role was made by hand and is none of our business
+		if !retiredRoles[role.ID] {
+			continue
+		}
+
+		var holders []string
+		for _, member := range members {
+			for _, name := range member.RoleNames {
+				if name == role.Name {
+					holders = append(holders, member.ID)
+				}
+			}
+		}
+
+		sort.Strings(holders)
+
+		deltas = append(deltas, DeltaRoleDelete{
+			RoleID:   role.ID,
+			RoleName: role.Name,
+			Holders:  holders,
+		})
+	}
+
 	return deltas, nil
 }
 
+// Unresolved returns the contributors whose Discord identity doesn't match
+// any member of the server, ordered by name.
+func Unresolved(config *governance.Config, state State) []governance.Person {
+	userIDs := indexMembers(state.Members)
+
+	var unresolved []governance.Person
+	for _, person := range config.Contributors {
+		if person.Discord == "" {
+			continue
+		}
+
+		_, found := userIDs.resolve(person.Discord)
+		if !found {
+			unresolved = append(unresolved, person)
+		}
+	}
+
+	sort.Slice(unresolved, func(i, j int) bool {
+		return unresolved[i].Name < unresolved[j].Name
+	})
+
+	return unresolved
+}
+
+// DiffNicknames computes the deltas necessary to set each linked
+// contributor's nickname to their name, unless they've opted out. Members the
+// bot isn't allowed to rename are returned instead, so they can be reported.
+func DiffNicknames(config *governance.Config, state State) ([]Delta, []DiscordMember) {
+	members := map[string]DiscordMember{}
+	for _, member := range state.Members {
+		members[member.ID] = member
+	}
+
+	rolePositions := map[string]int{}
+	for _, role := range state.Roles {
+		rolePositions[role.Name] = role.Position
+	}
+
+	topPosition := func(member DiscordMember) int {
+		top := 0
+		for _, roleName := range member.RoleNames {
+			if rolePositions[roleName] > top {
+				top = rolePositions[roleName]
+			}
+		}
+
+		return top
+	}
+
+	botPosition := topPosition(members[state.Guild.BotID])
+
+	userIDs := indexMembers(state.Members)
+
+	var deltas []Delta
+	var unrenamable []DiscordMember
+	for _, person := range config.Contributors {
+		if person.Discord == "" || person.KeepNickname || person.Name == "" {
+			continue
+		}
+
+		userID, found := userIDs.resolve(person.Discord)
+		if !found {
+			continue
+		}
+
+		member := members[userID]
+		if member.Nickname == person.Name {
+			continue
+		}
+
+		// the bot can only rename members below its highest role, and never the
+		// owner
+		if member.ID == state.Guild.OwnerID || topPosition(member) >= botPosition {
+			unrenamable = append(unrenamable, member)
+			continue
+		}
+
+		deltas = append(deltas, DeltaUserNickname{
+			UserID:   member.ID,
+			UserName: member.Name,
+			Nickname: person.Name,
+		})
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].(DeltaUserNickname).UserID < deltas[j].(DeltaUserNickname).UserID
+	})
+
+	sort.Slice(unrenamable, func(i, j int) bool {
+		return unrenamable[i].ID < unrenamable[j].ID
+	})
+
+	return deltas, unrenamable
+}
+
+// memberIDs maps each way a contributor may identify themselves to a member's
+// user ID: the ID itself, their unique username, or their legacy name#1234 tag.
+type memberIDs map[string]string
+
+func indexMembers(members []DiscordMember) memberIDs {
+	ids := memberIDs{}
+	for _, member := range members {
+		ids[member.ID] = member.ID
+		ids[member.Name] = member.ID
+
+		if member.Username != "" {
+			// usernames are case-insensitive
+			ids[strings.ToLower(member.Username)] = member.ID
+		}
+	}
+
+	return ids
+}
+
+func (ids memberIDs) resolve(handle string) (string, bool) {
+	id, found := ids[handle]
+	if !found {
+		id, found = ids[strings.ToLower(handle)]
+	}
+
+	return id, found
+}
+
+// diffChannels computes the deltas for a team's category and channels. The
+// role ID is empty if the role has yet to be created.
+func diffChannels(team governance.Team, roleName, roleID, everyoneRoleID string, channels []DiscordChannel) []Delta {
+	if len(team.Discord.Channels) == 0 {
+		return nil
+	}
+
+	var deltas []Delta
+
+	categoryName := team.CategoryName()
+
+	category, found := findChannel(channels, "", categoryName, governance.DiscordChannelCategory)
+	if !found {
+		deltas = append(deltas, DeltaChannelCreate{
+			Name:     categoryName,
+			Type:     governance.DiscordChannelCategory,
+			RoleName: roleName,
+		})
+	} else if !privateTo(category, roleID, everyoneRoleID) {
+		deltas = append(deltas, DeltaChannelEdit{
+			ChannelID: category.ID,
+			Name:      categoryName,
+			Type:      governance.DiscordChannelCategory,
+			RoleName:  roleName,
+		})
+	}
+
+	for _, desired := range team.Discord.Channels {
+		var actual DiscordChannel
+		var found bool
+		if category.ID != "" {
+			actual, found = findChannel(channels, category.ID, desired.Name, desired.ChannelType())
+		}
+
+		if !found {
+			deltas = append(deltas, DeltaChannelCreate{
+				Name:     desired.Name,
+				Type:     desired.ChannelType(),
+				Topic:    desired.Topic,
+				Category: categoryName,
+				RoleName: roleName,
+			})
+		} else if actual.Topic != desired.Topic || !privateTo(actual, roleID, everyoneRoleID) {
+			deltas = append(deltas, DeltaChannelEdit{
+				ChannelID: actual.ID,
+				Name:      desired.Name,
+				Type:      desired.ChannelType(),
+				Topic:     desired.Topic,
+				Category:  categoryName,
+				RoleName:  roleName,
+			})
+		}
+	}
+
+	return deltas
+}
+
+func findChannel(channels []DiscordChannel, parentID, name string, channelType governance.DiscordChannelType) (DiscordChannel, bool) {
+	for _, channel := range channels {
+		if channel.ParentID == parentID && channel.Name == name && channel.Type == channelType {
+			return channel, true
+		}
+	}
+
+	return DiscordChannel{}, false
+}
+
+// privateTo checks that only the given role is allowed to see the channel.
+func privateTo(channel DiscordChannel, roleID, everyoneRoleID string) bool {
+	if roleID == "" || everyoneRoleID == "" {
+		return false
+	}
+
+	allow, deny := channelAccess(channel.Type)
+
+	var allowed, denied bool
+	for _, overwrite := range channel.Overwrites {
+		switch overwrite.RoleID {
+		case roleID:
+			allowed = overwrite.Allow&allow == allow
+		case everyoneRoleID:
+			denied = overwrite.Deny&deny == deny
+		}
+	}
+
+	return allowed && denied
+}
+
+// channelAccess returns the permissions granted to the team's role and
+// denied to everyone else for a team channel.
+func channelAccess(channelType governance.DiscordChannelType) (int64, int64) {
+	view := governance.DiscordPermissions["VIEW_CHANNEL"]
+
+	allow := view
+	if channelType == governance.DiscordChannelVoice {
+		allow |= governance.DiscordPermissions["CONNECT"]
+	}
+
+	return allow, view
+}
+
+// everyoneRole is the name of the role every member of the server has.
+const everyoneRole = "@everyone"
+
+// managedRoleSuffix is appended to a team's name to form its default role
+// name.
+const managedRoleSuffix = "-team"
+
+// teamRoleName returns the name of the team's role, which defaults to the
+// team's name with managedRoleSuffix.
+func teamRoleName(team governance.Team) string {
+	if team.Discord.Role != "" {
+		return team.Discord.Role
+	}
+
+	return team.Name + managedRoleSuffix
+}
+
+// findRole finds a role by ID, if given, falling back to its name.
+func findRole(roles []DiscordRole, id, name string) (DiscordRole, bool) {
+	if id != "" {
+		for _, role := range roles {
+			if role.ID == id {
+				return role, true
+			}
+		}
+	}
+
+	for _, role := range roles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+
+	return DiscordRole{}, false
+}
+
 type byPosition []DiscordRole
 
 func (roles byPosition) Len() int { return len(roles) }
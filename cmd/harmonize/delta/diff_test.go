@@ -1,6 +1,8 @@
 package delta_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/concourse/governance"
@@ -121,6 +123,39 @@ func TestSynced(t *testing.T) {
 	require.Empty(t, diff)
 }
 
+func TestProvider(t *testing.T) {
+	runner := governance.Runner{
+		Providers: []governance.Provider{
+			delta.Provider{
+				Discord: fakeDiscord{
+					roles: syncedRoles,
+					members: []delta.DiscordMember{
+						{
+							ID:        "andrew-id",
+							Name:      "andrew#123",
+							RoleNames: []string{"all"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	plans, err := runner.Plan(context.Background(), config)
+	require.NoError(t, err)
+	require.Len(t, plans, 1)
+	require.Equal(t, []governance.ProviderDelta{
+		delta.DeltaUserAddRole{
+			UserID:   "andrew-id",
+			UserName: "andrew#123",
+			RoleName: "admin-team",
+		},
+	}, plans[0].Deltas)
+
+	err = runner.Apply(context.Background(), plans)
+	require.NoError(t, err)
+}
+
 func TestReorder(t *testing.T) {
 	discord := fakeDiscord{
 		roles: []delta.DiscordRole{
@@ -181,16 +216,22 @@ func TestEmptyRoleState(t *testing.T) {
 			RoleName:    "all",
 			Color:       0xabcdef,
 			Permissions: basePermissions,
+			Hoist:       true,
+			Mentionable: true,
 		},
 		delta.DeltaRoleCreate{
 			RoleName:    "banana-team",
 			Color:       0x123456,
 			Permissions: basePermissions,
+			Hoist:       true,
+			Mentionable: true,
 		},
 		delta.DeltaRoleCreate{
 			RoleName:    "admin-team",
 			Color:       0xbeefad,
 			Permissions: basePermissions | 0x8,
+			Hoist:       true,
+			Mentionable: true,
 		},
 		delta.DeltaRolePositions{
 			"all",
@@ -272,18 +313,328 @@ func TestRoleEdit(t *testing.T) {
 		delta.DeltaRoleEdit{
 			RoleID:      "banana-team-id",
 			RoleName:    "banana-team",
+			OldName:     "banana-team",
 			Color:       0x123456,
 			Permissions: basePermissions,
 		},
 		delta.DeltaRoleEdit{
 			RoleID:      "admin-team-id",
 			RoleName:    "admin-team",
+			OldName:     "admin-team",
 			Color:       0xbeefad,
 			Permissions: basePermissions | 0x8,
 		},
 	}, diff)
 }
 
+func TestRoleAttributes(t *testing.T) {
+	hoist, mentionable := true, false
+
+	attributed := *config
+	attributed.Teams = map[string]governance.Team{}
+	for name, team := range config.Teams {
+		attributed.Teams[name] = team
+	}
+
+	banana := attributed.Teams["banana"]
+	banana.Discord.Hoist = &hoist
+	banana.Discord.Mentionable = &mentionable
+	banana.Discord.Emoji = "🍌"
+	attributed.Teams["banana"] = banana
+
+	roles := append([]delta.DiscordRole{}, syncedRoles...)
+	roles[1].Mentionable = true
+
+	// unset attributes are left alone
+	roles[2].Hoist = true
+	roles[2].Emoji = "👑"
+
+	discord := fakeDiscord{
+		roles:   roles,
+		members: syncedMembers,
+	}
+
+	diff, err := delta.Diff(&attributed, discord)
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaRoleEdit{
+			RoleID:      "banana-team-id",
+			RoleName:    "banana-team",
+			OldName:     "banana-team",
+			Color:       0x123456,
+			Permissions: basePermissions,
+			Hoist:       true,
+			Mentionable: false,
+			Emoji:       "🍌",
+		},
+	}, diff)
+
+	roles[1].Hoist = true
+	roles[1].Mentionable = false
+	roles[1].Emoji = "🍌"
+
+	diff, err = delta.Diff(&attributed, discord)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func TestRoleRename(t *testing.T) {
+	renamed := *config
+	renamed.Teams = map[string]governance.Team{}
+	for name, team := range config.Teams {
+		renamed.Teams[name] = team
+	}
+
+	banana := renamed.Teams["banana"]
+	banana.Discord.Role = "bananas"
+	banana.Discord.RoleID = "banana-team-id"
+	renamed.Teams["banana"] = banana
+
+	discord := fakeDiscord{
+		roles:   syncedRoles,
+		members: syncedMembers,
+	}
+
+	diff, err := delta.Diff(&renamed, discord)
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaRoleEdit{
+			RoleID:      "banana-team-id",
+			RoleName:    "bananas",
+			OldName:     "banana-team",
+			Color:       0x123456,
+			Permissions: basePermissions,
+		},
+	}, diff)
+}
+
+func TestOrphanedRoleDelete(t *testing.T) {
+	retired := *config
+	retired.RetiredRoles = []governance.RetiredRole{
+		{ID: "old-id", Name: "old"},
+		{ID: "missing-id", Name: "long-gone"},
+	}
+
+	discord := fakeDiscord{
+		roles: append([]delta.DiscordRole{
+			{
+				ID:          "old-id",
+				Name:        "old",
+				Permissions: basePermissions,
+				Position:    4,
+			},
+			{
+				ID:       "moderators-id",
+				Name:     "moderators",
+				Position: 5,
+			},
+			{
+				ID:       "design-team-id",
+				Name:     "design-team",
+				Position: 6,
+			},
+		}, syncedRoles...),
+		members: append([]delta.DiscordMember{
+			{
+				ID:        "onion-id",
+				Name:      "onion#789",
+				RoleNames: []string{"old", "moderators", "design-team", "all"},
+			},
+			{
+				ID:        "leek-id",
+				Name:      "leek#321",
+				RoleNames: []string{"old", "all"},
+			},
+		}, syncedMembers...),
+	}
+
+	diff, err := delta.Diff(&retired, discord)
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaRoleDelete{
+			RoleID:   "old-id",
+			RoleName: "old",
+			Holders:  []string{"leek-id", "onion-id"},
+		},
+	}, diff)
+
+	removal, ok := diff[0].(governance.MultiRemoval)
+	require.True(t, ok)
+	require.Equal(t, []string{"leek-id", "onion-id"}, removal.RemovalSubjects())
+
+	// roles are only deleted once recorded as retired, whatever their name
+	diff, err = delta.Diff(config, discord)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func TestChannels(t *testing.T) {
+	withChannels := *config
+	withChannels.Teams = map[string]governance.Team{}
+	for name, team := range config.Teams {
+		withChannels.Teams[name] = team
+	}
+
+	banana := withChannels.Teams["banana"]
+	banana.Discord.Channels = []governance.DiscordChannel{
+		{Name: "general", Topic: "All about bananas."},
+		{Name: "Banana Hangout", Type: governance.DiscordChannelVoice},
+	}
+	withChannels.Teams["banana"] = banana
+
+	view := governance.DiscordPermissions["VIEW_CHANNEL"]
+	connect := governance.DiscordPermissions["CONNECT"]
+
+	roles := append([]delta.DiscordRole{
+		{
+			ID:   "everyone-id",
+			Name: "@everyone",
+		},
+	}, syncedRoles...)
+
+	diff, err := delta.Diff(&withChannels, fakeDiscord{
+		roles:   roles,
+		members: syncedMembers,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaChannelCreate{
+			Name:     "banana",
+			Type:     governance.DiscordChannelCategory,
+			RoleName: "banana-team",
+		},
+		delta.DeltaChannelCreate{
+			Name:     "general",
+			Type:     governance.DiscordChannelText,
+			Topic:    "All about bananas.",
+			Category: "banana",
+			RoleName: "banana-team",
+		},
+		delta.DeltaChannelCreate{
+			Name:     "Banana Hangout",
+			Type:     governance.DiscordChannelVoice,
+			Category: "banana",
+			RoleName: "banana-team",
+		},
+	}, diff)
+
+	private := func(allow int64) []delta.DiscordOverwrite {
+		return []delta.DiscordOverwrite{
+			{RoleID: "everyone-id", Deny: view},
+			{RoleID: "banana-team-id", Allow: allow},
+		}
+	}
+
+	channels := []delta.DiscordChannel{
+		{
+			ID:         "category-id",
+			Name:       "banana",
+			Type:       governance.DiscordChannelCategory,
+			Overwrites: private(view),
+		},
+		{
+			ID:         "general-id",
+			Name:       "general",
+			Type:       governance.DiscordChannelText,
+			ParentID:   "category-id",
+			Topic:      "All about bananas.",
+			Overwrites: private(view),
+		},
+		{
+			ID:         "hangout-id",
+			Name:       "Banana Hangout",
+			Type:       governance.DiscordChannelVoice,
+			ParentID:   "category-id",
+			Overwrites: private(view | connect),
+		},
+	}
+
+	diff, err = delta.Diff(&withChannels, fakeDiscord{
+		roles:    roles,
+		members:  syncedMembers,
+		channels: channels,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	channels[1].Topic = "Plantains."
+	channels[2].Overwrites = []delta.DiscordOverwrite{
+		{RoleID: "banana-team-id", Allow: view},
+	}
+
+	diff, err = delta.Diff(&withChannels, fakeDiscord{
+		roles:    roles,
+		members:  syncedMembers,
+		channels: channels,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaChannelEdit{
+			ChannelID: "general-id",
+			Name:      "general",
+			Type:      governance.DiscordChannelText,
+			Topic:     "All about bananas.",
+			Category:  "banana",
+			RoleName:  "banana-team",
+		},
+		delta.DeltaChannelEdit{
+			ChannelID: "hangout-id",
+			Name:      "Banana Hangout",
+			Type:      governance.DiscordChannelVoice,
+			Category:  "banana",
+			RoleName:  "banana-team",
+		},
+	}, diff)
+}
+
+func TestNicknames(t *testing.T) {
+	named := *config
+	named.Contributors = map[string]governance.Person{
+		"andrew": {Name: "Andrew", Discord: "andrew#123"},
+		"potato": {Name: "Potato", Discord: "potato#456"},
+		"onion":  {Name: "Onion", Discord: "onion#789", KeepNickname: true},
+		"garlic": {Name: "Garlic", Discord: "garlic#111"},
+		"leek":   {Name: "Leek", Discord: "leek#222"},
+	}
+
+	state := delta.State{
+		Guild: delta.DiscordGuild{
+			OwnerID: "garlic-id",
+			BotID:   "bot-id",
+		},
+		Roles: append([]delta.DiscordRole{
+			{
+				ID:       "bot-role-id",
+				Name:     "bot",
+				Position: 50,
+			},
+		}, syncedRoles...),
+		Members: []delta.DiscordMember{
+			{ID: "bot-id", Name: "bot#000", RoleNames: []string{"bot"}},
+			{ID: "andrew-id", Name: "andrew#123", RoleNames: []string{"all"}},
+			{ID: "potato-id", Name: "potato#456", Nickname: "Potato"},
+			{ID: "onion-id", Name: "onion#789", Nickname: "oniony"},
+			{ID: "garlic-id", Name: "garlic#111"},
+			{ID: "leek-id", Name: "leek#222", RoleNames: []string{"bot"}},
+		},
+	}
+
+	diff, unrenamable := delta.DiffNicknames(&named, state)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaUserNickname{
+			UserID:   "andrew-id",
+			UserName: "andrew#123",
+			Nickname: "Andrew",
+		},
+	}, diff)
+	require.Equal(t, []delta.DiscordMember{state.Members[4], state.Members[5]}, unrenamable)
+
+	discord := fakeDiscord{nicknameErr: errors.New("missing permissions")}
+
+	err := diff[0].Apply(zap.NewNop(), discord)
+	require.EqualError(t, err, "missing permissions")
+}
+
 func TestUserRoleAddRemove(t *testing.T) {
 	discord := fakeDiscord{
 		roles: syncedRoles,
@@ -322,6 +673,52 @@ func TestUserRoleAddRemove(t *testing.T) {
 	}, diff)
 }
 
+func TestUserIdentity(t *testing.T) {
+	identified := *config
+	identified.Contributors = map[string]governance.Person{
+		"andrew": {Name: "andrew", Discord: "andrew-id"},
+		"potato": {Name: "potato", Discord: "Potato"},
+		"onion":  {Name: "onion", Discord: "onion#789"},
+		"garlic": {Name: "garlic", Discord: "garlic#111"},
+	}
+
+	members := []delta.DiscordMember{
+		{
+			ID:        "andrew-id",
+			Name:      "andy#0",
+			Username:  "andy",
+			RoleNames: []string{"admin-team", "all"},
+		},
+		{
+			ID:        "potato-id",
+			Name:      "potato#0",
+			Username:  "potato",
+			RoleNames: []string{"banana-team", "all"},
+		},
+		{
+			ID:        "onion-id",
+			Name:      "onion#789",
+			Username:  "onion",
+			RoleNames: []string{"all"},
+		},
+	}
+
+	diff, err := delta.Diff(&identified, fakeDiscord{
+		roles:   syncedRoles,
+		members: members,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	unresolved := delta.Unresolved(&identified, delta.State{
+		Members: members,
+		Roles:   syncedRoles,
+	})
+	require.Equal(t, []governance.Person{
+		{Name: "garlic", Discord: "garlic#111"},
+	}, unresolved)
+}
+
 func TestUserRoleIgnoreUnknown(t *testing.T) {
 	roles := []delta.DiscordRole{
 		{
@@ -391,9 +788,39 @@ func TestUserRoleIgnoreSticky(t *testing.T) {
 	require.Empty(t, diff)
 }
 
+func TestDependencies(t *testing.T) {
+	provides := func(d governance.Dependent) []string { return d.Provides() }
+	dependsOn := func(d governance.Dependent) []string { return d.DependsOn() }
+
+	role := provides(delta.DeltaRoleCreate{RoleName: "core"})
+	require.Equal(t, role, provides(delta.DeltaRoleEdit{RoleID: "core-id", RoleName: "core", OldName: "core-team"}))
+	require.Empty(t, provides(delta.DeltaRoleEdit{RoleID: "core-id", RoleName: "core", OldName: "core"}))
+	require.Equal(t, role, dependsOn(delta.DeltaUserAddRole{UserID: "alice-id", RoleName: "core"}))
+	require.Contains(t, dependsOn(delta.DeltaRolePositions{"all", "core"}), role[0])
+
+	category := provides(delta.DeltaChannelCreate{Name: "core", Type: governance.DiscordChannelCategory, RoleName: "core"})
+	require.Len(t, category, 1)
+
+	channel := dependsOn(delta.DeltaChannelCreate{Name: "chat", Category: "core", RoleName: "core"})
+	require.ElementsMatch(t, append(role, category...), channel)
+	require.Empty(t, provides(delta.DeltaChannelCreate{Name: "chat", Category: "core", RoleName: "core"}))
+
+	// removals and nicknames never wait on anything
+	require.Empty(t, dependsOn(delta.DeltaUserRemoveRole{UserID: "alice-id", RoleName: "core"}))
+	require.Empty(t, dependsOn(delta.DeltaUserNickname{UserID: "alice-id", Nickname: "Alice"}))
+}
+
 type fakeDiscord struct {
-	members []delta.DiscordMember
-	roles   []delta.DiscordRole
+	guild    delta.DiscordGuild
+	members  []delta.DiscordMember
+	roles    []delta.DiscordRole
+	channels []delta.DiscordChannel
+
+	nicknameErr error
+}
+
+func (discord fakeDiscord) Guild() (delta.DiscordGuild, error) {
+	return discord.guild, nil
 }
 
 func (discord fakeDiscord) Members() ([]delta.DiscordMember, error) {
@@ -404,8 +831,20 @@ func (discord fakeDiscord) Roles() ([]delta.DiscordRole, error) {
 	return discord.roles, nil
 }
 
+func (discord fakeDiscord) Channels() ([]delta.DiscordChannel, error) {
+	return discord.channels, nil
+}
+
 func (discord fakeDiscord) CreateRole(delta.DeltaRoleCreate) error          { return nil }
 func (discord fakeDiscord) EditRole(delta.DeltaRoleEdit) error              { return nil }
+func (discord fakeDiscord) DeleteRole(delta.DeltaRoleDelete) error          { return nil }
 func (discord fakeDiscord) SetRolePositions(delta.DeltaRolePositions) error { return nil }
+func (discord fakeDiscord) CreateChannel(delta.DeltaChannelCreate) error    { return nil }
+func (discord fakeDiscord) EditChannel(delta.DeltaChannelEdit) error        { return nil }
+func (discord fakeDiscord) DeleteChannel(delta.DeltaChannelDelete) error    { return nil }
 func (discord fakeDiscord) AddUserRole(delta.DeltaUserAddRole) error        { return nil }
 func (discord fakeDiscord) RemoveUserRole(delta.DeltaUserRemoveRole) error  { return nil }
+
+func (discord fakeDiscord) SetNickname(delta.DeltaUserNickname) error {
+	return discord.nicknameErr
+}
@@ -1,26 +1,52 @@
 package delta
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/concourse/governance"
 )
 
 type Discord interface {
+	Guild() (DiscordGuild, error)
 	Members() ([]DiscordMember, error)
 	Roles() ([]DiscordRole, error)
 
 	CreateRole(DeltaRoleCreate) error
 	EditRole(DeltaRoleEdit) error
+	DeleteRole(DeltaRoleDelete) error
 	SetRolePositions(DeltaRolePositions) error
 
+	Channels() ([]DiscordChannel, error)
+	CreateChannel(DeltaChannelCreate) error
+	EditChannel(DeltaChannelEdit) error
+	DeleteChannel(DeltaChannelDelete) error
+
 	AddUserRole(DeltaUserAddRole) error
 	RemoveUserRole(DeltaUserRemoveRole) error
+	SetNickname(DeltaUserNickname) error
+}
+
+// DiscordGuild identifies the members who can't be renamed regardless of
+// their roles.
+type DiscordGuild struct {
+	OwnerID string
+	BotID   string
 }
 
 type DiscordMember struct {
-	ID        string
-	Name      string
+	ID   string
+	Name string
+
+	// Username is the member's unique username, without the legacy
+	// discriminator included in Name.
+	Username string
+
+	// Nickname is the member's name on this server, if set.
+	Nickname string
+
 	RoleNames []string
 }
 
@@ -30,11 +56,44 @@ type DiscordRole struct {
 	Color       int
 	Permissions int64
 	Position    int
+	Hoist       bool
+	Mentionable bool
+	Emoji       string
+}
+
+type DiscordChannel struct {
+	ID       string
+	Name     string
+	Type     governance.DiscordChannelType
+	ParentID string
+	Topic    string
+
+	// Overwrites lists the channel's role permission overwrites; member
+	// overwrites aren't managed.
+	Overwrites []DiscordOverwrite
+}
+
+type DiscordOverwrite struct {
+	RoleID string
+	Allow  int64
+	Deny   int64
 }
 
+// discord snapshots the roles, members, and channels the first time they're
+// needed and keeps the snapshot up to date as deltas are applied, rather than
+// fetching them again for every delta. A new client should be made for each
+// run to pick up changes made elsewhere.
+//
+// Requests are limited per route by discordgo's rate limiter, which is shared
+// by concurrent deltas.
 type discord struct {
 	session *discordgo.Session
 	guildID string
+
+	lock     sync.Mutex
+	roles    []guildRole
+	members  []*discordgo.Member
+	channels []*discordgo.Channel
 }
 
 func NewDiscord(guildID, token string) (Discord, error) {
@@ -43,68 +102,88 @@ func NewDiscord(guildID, token string) (Discord, error) {
 		return nil, fmt.Errorf("init discordgo: %w", err)
 	}
 
+	return NewDiscordSession(guildID, session), nil
+}
+
+// NewDiscordSession is like NewDiscord but with an existing session, e.g. one
+// with its own HTTP client.
+func NewDiscordSession(guildID string, session *discordgo.Session) Discord {
 	return &discord{
 		session: session,
 		guildID: guildID,
+	}
+}
+
+func (discord *discord) Guild() (DiscordGuild, error) {
+	guild, err := discord.session.Guild(discord.guildID)
+	if err != nil {
+		return DiscordGuild{}, fmt.Errorf("get guild: %w", err)
+	}
+
+	bot, err := discord.session.User("@me")
+	if err != nil {
+		return DiscordGuild{}, fmt.Errorf("get bot user: %w", err)
+	}
+
+	return DiscordGuild{
+		OwnerID: guild.OwnerID,
+		BotID:   bot.ID,
 	}, nil
 }
 
 func (discord *discord) Members() ([]DiscordMember, error) {
-	discordMembers := []DiscordMember{}
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
 
-	discordRoles, err := discord.session.GuildRoles(discord.guildID)
+	roles, err := discord.loadRoles()
 	if err != nil {
-		return nil, fmt.Errorf("get guild roles: %w", err)
+		return nil, err
 	}
 
-	after := ""
-	limit := 1000
-	for {
-		members, err := discord.session.GuildMembers(discord.guildID, after, limit)
-		if err != nil {
-			return nil, fmt.Errorf("get guild members: %w", err)
-		}
-
-		for _, member := range members {
-			roleNames := make([]string, len(member.Roles))
-
-			for i, roleID := range member.Roles {
-				var roleName string
-				for _, role := range discordRoles {
-					if role.ID == roleID {
-						roleName = role.Name
-						break
-					}
-				}
+	members, err := discord.loadMembers()
+	if err != nil {
+		return nil, err
+	}
 
-				if roleName == "" {
-					return nil, fmt.Errorf("could not find name for role %s (user %s)", roleID, member.User)
+	discordMembers := []DiscordMember{}
+	for _, member := range members {
+		roleNames := make([]string, len(member.Roles))
+
+		for i, roleID := range member.Roles {
+			var roleName string
+			for _, role := range roles {
+				if role.ID == roleID {
+					roleName = role.Name
+					break
 				}
-
-				roleNames[i] = roleName
 			}
 
-			discordMembers = append(discordMembers, DiscordMember{
-				ID:        member.User.ID,
-				Name:      member.User.String(),
-				RoleNames: roleNames,
-			})
+			if roleName == "" {
+				return nil, fmt.Errorf("could not find name for role %s (user %s)", roleID, member.User)
+			}
 
-			after = member.User.ID
+			roleNames[i] = roleName
 		}
 
-		if len(members) < limit {
-			break
-		}
+		discordMembers = append(discordMembers, DiscordMember{
+			ID:        member.User.ID,
+			Name:      member.User.String(),
+			Username:  member.User.Username,
+			Nickname:  member.Nick,
+			RoleNames: roleNames,
+		})
 	}
 
 	return discordMembers, nil
 }
 
 func (discord *discord) Roles() ([]DiscordRole, error) {
-	discordRoles, err := discord.session.GuildRoles(discord.guildID)
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	discordRoles, err := discord.loadRoles()
 	if err != nil {
-		return nil, fmt.Errorf("get guild roles: %w", err)
+		return nil, err
 	}
 
 	roles := make([]DiscordRole, len(discordRoles))
@@ -115,6 +194,9 @@ func (discord *discord) Roles() ([]DiscordRole, error) {
 			Color:       r.Color,
 			Permissions: r.Permissions,
 			Position:    r.Position,
+			Hoist:       r.Hoist,
+			Mentionable: r.Mentionable,
+			Emoji:       r.UnicodeEmoji,
 		}
 	}
 
@@ -127,43 +209,120 @@ func (discord *discord) CreateRole(delta DeltaRoleCreate) error {
 		return fmt.Errorf("create role: %w", err)
 	}
 
-	_, err = discord.session.GuildRoleEdit(
-		discord.guildID,
-		role.ID,
-		delta.RoleName,
-		delta.Color,
-		true,
-		delta.Permissions,
-		true,
-	)
+	edited, err := discord.editRole(role.ID, roleParams{
+		Name:         delta.RoleName,
+		Color:        delta.Color,
+		Permissions:  delta.Permissions,
+		Hoist:        delta.Hoist,
+		Mentionable:  delta.Mentionable,
+		UnicodeEmoji: delta.Emoji,
+	})
 	if err != nil {
 		return fmt.Errorf("edit newly created role: %w", err)
 	}
 
+	discord.lock.Lock()
+	discord.roles = append(discord.roles, edited)
+	discord.lock.Unlock()
+
 	return nil
 }
 
 func (discord *discord) EditRole(delta DeltaRoleEdit) error {
-	_, err := discord.session.GuildRoleEdit(
-		discord.guildID,
-		delta.RoleID,
-		delta.RoleName,
-		delta.Color,
-		true,
-		delta.Permissions,
-		true,
+	edited, err := discord.editRole(delta.RoleID, roleParams{
+		Name:         delta.RoleName,
+		Color:        delta.Color,
+		Permissions:  delta.Permissions,
+		Hoist:        delta.Hoist,
+		Mentionable:  delta.Mentionable,
+		UnicodeEmoji: delta.Emoji,
+	})
+	if err != nil {
+		return fmt.Errorf("edit role: %w", err)
+	}
+
+	discord.lock.Lock()
+	for i, role := range discord.roles {
+		if role.ID == edited.ID {
+			discord.roles[i] = edited
+		}
+	}
+	discord.lock.Unlock()
+
+	return nil
+}
+
+// guildRole is a discordgo.Role along with the fields discordgo doesn't
+// support yet.
+type guildRole struct {
+	discordgo.Role
+
+	UnicodeEmoji string `json:"unicode_emoji"`
+}
+
+type roleParams struct {
+	Name         string `json:"name"`
+	Color        int    `json:"color"`
+	Permissions  int64  `json:"permissions,string"`
+	Hoist        bool   `json:"hoist"`
+	Mentionable  bool   `json:"mentionable"`
+	UnicodeEmoji string `json:"unicode_emoji,omitempty"`
+}
+
+// editRole is like discordgo's GuildRoleEdit, but can also set the role's
+// icon.
+func (discord *discord) editRole(roleID string, params roleParams) (guildRole, error) {
+	body, err := discord.session.RequestWithBucketID(
+		"PATCH",
+		discordgo.EndpointGuildRole(discord.guildID, roleID),
+		params,
+		discordgo.EndpointGuildRole(discord.guildID, ""),
 	)
 	if err != nil {
-		return fmt.Errorf("edit newly created role: %w", err)
+		return guildRole{}, err
+	}
+
+	var role guildRole
+	err = json.Unmarshal(body, &role)
+	if err != nil {
+		return guildRole{}, fmt.Errorf("decode role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (discord *discord) DeleteRole(delta DeltaRoleDelete) error {
+	err := discord.session.GuildRoleDelete(discord.guildID, delta.RoleID)
+	if err != nil {
+		return fmt.Errorf("delete role: %w", err)
+	}
+
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	var roles []guildRole
+	for _, role := range discord.roles {
+		if role.ID != delta.RoleID {
+			roles = append(roles, role)
+		}
+	}
+
+	discord.roles = roles
+
+	for _, member := range discord.members {
+		member.Roles = without(member.Roles, delta.RoleID)
 	}
 
 	return nil
 }
 
 func (discord *discord) SetRolePositions(delta DeltaRolePositions) error {
-	roles, err := discord.session.GuildRoles(discord.guildID)
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	roles, err := discord.loadRoles()
 	if err != nil {
-		return fmt.Errorf("get guild roles: %w", err)
+		return err
 	}
 
 	var orderedRoles []*discordgo.Role
@@ -172,7 +331,7 @@ func (discord *discord) SetRolePositions(delta DeltaRolePositions) error {
 		for _, role := range roles {
 			if role.Name == roleName {
 				role.Position = position + 1
-				orderedRoles = append(orderedRoles, role)
+				orderedRoles = append(orderedRoles, &role.Role)
 				foundRole = true
 				break
 			}
@@ -183,14 +342,237 @@ func (discord *discord) SetRolePositions(delta DeltaRolePositions) error {
 		}
 	}
 
-	_, err = discord.session.GuildRoleReorder(discord.guildID, orderedRoles)
+	reordered, err := discord.session.GuildRoleReorder(discord.guildID, orderedRoles)
 	if err != nil {
 		return fmt.Errorf("reorder roles: %w", err)
 	}
 
+	// the response has every role's new position
+	for _, role := range reordered {
+		for i := range discord.roles {
+			if discord.roles[i].ID == role.ID {
+				discord.roles[i].Position = role.Position
+			}
+		}
+	}
+
+	return nil
+}
+
+func (discord *discord) Channels() ([]DiscordChannel, error) {
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	discordChannels, err := discord.loadChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []DiscordChannel
+	for _, c := range discordChannels {
+		channelType, found := channelTypes[c.Type]
+		if !found {
+			// not something we manage
+			continue
+		}
+
+		channel := DiscordChannel{
+			ID:       c.ID,
+			Name:     c.Name,
+			Type:     channelType,
+			ParentID: c.ParentID,
+			Topic:    c.Topic,
+		}
+
+		for _, overwrite := range c.PermissionOverwrites {
+			if overwrite.Type != discordgo.PermissionOverwriteTypeRole {
+				continue
+			}
+
+			channel.Overwrites = append(channel.Overwrites, DiscordOverwrite{
+				RoleID: overwrite.ID,
+				Allow:  overwrite.Allow,
+				Deny:   overwrite.Deny,
+			})
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
+
+func (discord *discord) CreateChannel(delta DeltaChannelCreate) error {
+	data := discordgo.GuildChannelCreateData{
+		Name:  delta.Name,
+		Type:  discordChannelType(delta.Type),
+		Topic: delta.Topic,
+	}
+
+	if delta.Category != "" {
+		parentID, err := discord.categoryID(delta.Category)
+		if err != nil {
+			return err
+		}
+
+		data.ParentID = parentID
+	}
+
+	roleID, err := discord.roleID(delta.RoleName)
+	if err != nil {
+		return err
+	}
+
+	allow, deny := channelAccess(delta.Type)
+	data.PermissionOverwrites = []*discordgo.PermissionOverwrite{
+		{
+			ID:   discord.guildID,
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: deny,
+		},
+		{
+			ID:    roleID,
+			Type:  discordgo.PermissionOverwriteTypeRole,
+			Allow: allow,
+		},
+	}
+
+	channel, err := discord.session.GuildChannelCreateComplex(discord.guildID, data)
+	if err != nil {
+		return fmt.Errorf("create channel: %w", err)
+	}
+
+	discord.lock.Lock()
+	discord.channels = append(discord.channels, channel)
+	discord.lock.Unlock()
+
+	return nil
+}
+
+func (discord *discord) EditChannel(delta DeltaChannelEdit) error {
+	edit := &discordgo.ChannelEdit{
+		Name:  delta.Name,
+		Topic: delta.Topic,
+	}
+
+	if delta.Category != "" {
+		parentID, err := discord.categoryID(delta.Category)
+		if err != nil {
+			return err
+		}
+
+		edit.ParentID = parentID
+	}
+
+	discord.lock.Lock()
+	channels, err := discord.loadChannels()
+	if err == nil {
+		// position is always sent, so keep it where it is
+		for _, channel := range channels {
+			if channel.ID == delta.ChannelID {
+				edit.Position = channel.Position
+			}
+		}
+	}
+	discord.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = discord.session.ChannelEditComplex(delta.ChannelID, edit)
+	if err != nil {
+		return fmt.Errorf("edit channel: %w", err)
+	}
+
+	roleID, err := discord.roleID(delta.RoleName)
+	if err != nil {
+		return err
+	}
+
+	allow, deny := channelAccess(delta.Type)
+
+	err = discord.session.ChannelPermissionSet(delta.ChannelID, discord.guildID, discordgo.PermissionOverwriteTypeRole, 0, deny)
+	if err != nil {
+		return fmt.Errorf("deny @everyone: %w", err)
+	}
+
+	err = discord.session.ChannelPermissionSet(delta.ChannelID, roleID, discordgo.PermissionOverwriteTypeRole, allow, 0)
+	if err != nil {
+		return fmt.Errorf("allow role: %w", err)
+	}
+
+	// refetched rather than patched up, since the overwrites have changed too
+	edited, err := discord.session.Channel(delta.ChannelID)
+	if err != nil {
+		return fmt.Errorf("get channel: %w", err)
+	}
+
+	discord.lock.Lock()
+	for i, channel := range discord.channels {
+		if channel.ID == edited.ID {
+			discord.channels[i] = edited
+		}
+	}
+	discord.lock.Unlock()
+
+	return nil
+}
+
+func (discord *discord) DeleteChannel(delta DeltaChannelDelete) error {
+	_, err := discord.session.ChannelDelete(delta.ChannelID)
+	if err != nil {
+		return fmt.Errorf("delete channel: %w", err)
+	}
+
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	var channels []*discordgo.Channel
+	for _, channel := range discord.channels {
+		if channel.ID != delta.ChannelID {
+			channels = append(channels, channel)
+		}
+	}
+
+	discord.channels = channels
+
 	return nil
 }
 
+func (discord *discord) categoryID(name string) (string, error) {
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	channels, err := discord.loadChannels()
+	if err != nil {
+		return "", err
+	}
+
+	for _, channel := range channels {
+		if channel.Type == discordgo.ChannelTypeGuildCategory && channel.Name == name {
+			return channel.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("category not found: %s", name)
+}
+
+var channelTypes = map[discordgo.ChannelType]governance.DiscordChannelType{
+	discordgo.ChannelTypeGuildText:     governance.DiscordChannelText,
+	discordgo.ChannelTypeGuildVoice:    governance.DiscordChannelVoice,
+	discordgo.ChannelTypeGuildCategory: governance.DiscordChannelCategory,
+}
+
+func discordChannelType(channelType governance.DiscordChannelType) discordgo.ChannelType {
+	for discordType, t := range channelTypes {
+		if t == channelType {
+			return discordType
+		}
+	}
+
+	return discordgo.ChannelTypeGuildText
+}
+
 func (discord *discord) AddUserRole(delta DeltaUserAddRole) error {
 	roleID, err := discord.roleID(delta.RoleName)
 	if err != nil {
@@ -202,6 +584,10 @@ func (discord *discord) AddUserRole(delta DeltaUserAddRole) error {
 		return fmt.Errorf("add user role: %w", err)
 	}
 
+	discord.updateMember(delta.UserID, func(member *discordgo.Member) {
+		member.Roles = append(without(member.Roles, roleID), roleID)
+	})
+
 	return nil
 }
 
@@ -211,18 +597,38 @@ func (discord *discord) RemoveUserRole(delta DeltaUserRemoveRole) error {
 		return err
 	}
 
-	err = discord.session.GuildMemberRoleAdd(discord.guildID, delta.UserID, roleID)
+	err = discord.session.GuildMemberRoleRemove(discord.guildID, delta.UserID, roleID)
 	if err != nil {
-		return fmt.Errorf("add user role: %w", err)
+		return fmt.Errorf("remove user role: %w", err)
+	}
+
+	discord.updateMember(delta.UserID, func(member *discordgo.Member) {
+		member.Roles = without(member.Roles, roleID)
+	})
+
+	return nil
+}
+
+func (discord *discord) SetNickname(delta DeltaUserNickname) error {
+	err := discord.session.GuildMemberNickname(discord.guildID, delta.UserID, delta.Nickname)
+	if err != nil {
+		return fmt.Errorf("set nickname: %w", err)
 	}
 
+	discord.updateMember(delta.UserID, func(member *discordgo.Member) {
+		member.Nick = delta.Nickname
+	})
+
 	return nil
 }
 
 func (discord *discord) roleID(roleName string) (string, error) {
-	roles, err := discord.session.GuildRoles(discord.guildID)
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	roles, err := discord.loadRoles()
 	if err != nil {
-		return "", fmt.Errorf("get guild roles: %w", err)
+		return "", err
 	}
 
 	for _, role := range roles {
@@ -233,3 +639,104 @@ func (discord *discord) roleID(roleName string) (string, error) {
 
 	return "", fmt.Errorf("role not found: %s", roleName)
 }
+
+// updateMember applies a change to the snapshot, if the member is in it.
+func (discord *discord) updateMember(userID string, update func(*discordgo.Member)) {
+	discord.lock.Lock()
+	defer discord.lock.Unlock()
+
+	for _, member := range discord.members {
+		if member.User.ID == userID {
+			update(member)
+		}
+	}
+}
+
+// loadRoles fetches the roles the first time they're needed. The lock must be
+// held.
+func (discord *discord) loadRoles() ([]guildRole, error) {
+	if discord.roles != nil {
+		return discord.roles, nil
+	}
+
+	// fetched directly, since discordgo doesn't know about role icons
+	endpoint := discordgo.EndpointGuildRoles(discord.guildID)
+	body, err := discord.session.RequestWithBucketID("GET", endpoint, nil, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("get guild roles: %w", err)
+	}
+
+	roles := []guildRole{}
+	err = json.Unmarshal(body, &roles)
+	if err != nil {
+		return nil, fmt.Errorf("decode guild roles: %w", err)
+	}
+
+	discord.roles = roles
+
+	return roles, nil
+}
+
+// loadMembers fetches every member the first time they're needed. The lock
+// must be held.
+func (discord *discord) loadMembers() ([]*discordgo.Member, error) {
+	if discord.members != nil {
+		return discord.members, nil
+	}
+
+	all := []*discordgo.Member{}
+
+	after := ""
+	limit := 1000
+	for {
+		members, err := discord.session.GuildMembers(discord.guildID, after, limit)
+		if err != nil {
+			return nil, fmt.Errorf("get guild members: %w", err)
+		}
+
+		for _, member := range members {
+			all = append(all, member)
+			after = member.User.ID
+		}
+
+		if len(members) < limit {
+			break
+		}
+	}
+
+	discord.members = all
+
+	return all, nil
+}
+
+// loadChannels fetches the channels the first time they're needed. The lock
+// must be held.
+func (discord *discord) loadChannels() ([]*discordgo.Channel, error) {
+	if discord.channels != nil {
+		return discord.channels, nil
+	}
+
+	channels, err := discord.session.GuildChannels(discord.guildID)
+	if err != nil {
+		return nil, fmt.Errorf("get guild channels: %w", err)
+	}
+
+	if channels == nil {
+		channels = []*discordgo.Channel{}
+	}
+
+	discord.channels = channels
+
+	return channels, nil
+}
+
+func without(ids []string, id string) []string {
+	var remaining []string
+	for _, existing := range ids {
+		if existing != id {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	return remaining
+}
@@ -0,0 +1,223 @@
+package delta_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/delta"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testGuildID = "1"
+
+func TestDiscordSnapshot(t *testing.T) {
+	api := newFakeAPI(t)
+
+	discord := delta.NewDiscordSession(testGuildID, api.session())
+
+	// loaded up front, as in a run
+	members, err := discord.Members()
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+
+	for _, user := range []string{"10", "11", "12"} {
+		err := discord.AddUserRole(delta.DeltaUserAddRole{UserID: user, RoleName: "core"})
+		require.NoError(t, err)
+	}
+
+	err = discord.RemoveUserRole(delta.DeltaUserRemoveRole{UserID: "10", RoleName: "k8s"})
+	require.NoError(t, err)
+
+	members, err = discord.Members()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []delta.DiscordMember{
+		{ID: "10", Name: "alice#0001", Username: "alice", RoleNames: []string{"core"}},
+		{ID: "11", Name: "bob#0002", Username: "bob", RoleNames: []string{"core"}},
+		{ID: "12", Name: "carol#0003", Username: "carol", RoleNames: []string{"k8s", "core"}},
+	}, members)
+
+	roles, err := discord.Roles()
+	require.NoError(t, err)
+	require.Len(t, roles, 3)
+
+	require.Equal(t, map[string]int{
+		"GET /guilds/1/roles":                1,
+		"GET /guilds/1/members":              1,
+		"PUT /guilds/1/members/10/roles/101": 1,
+		"PUT /guilds/1/members/11/roles/101": 1,
+		"PUT /guilds/1/members/12/roles/101": 1,
+		// removing the role, not adding it again
+		"DELETE /guilds/1/members/10/roles/102": 1,
+	}, api.requests())
+}
+
+func TestDiscordSnapshotConcurrent(t *testing.T) {
+	api := newFakeAPI(t)
+
+	discord := delta.NewDiscordSession(testGuildID, api.session())
+
+	// loaded up front, as in a run
+	members, err := discord.Members()
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+
+	wg := new(sync.WaitGroup)
+	for _, user := range []string{"10", "11", "12"} {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+
+			err := discord.AddUserRole(delta.DeltaUserAddRole{UserID: user, RoleName: "core"})
+			require.NoError(t, err)
+
+			err = discord.SetNickname(delta.DeltaUserNickname{UserID: user, Nickname: "nick " + user})
+			require.NoError(t, err)
+		}(user)
+	}
+
+	wg.Wait()
+
+	members, err = discord.Members()
+	require.NoError(t, err)
+
+	for _, member := range members {
+		require.Contains(t, member.RoleNames, "core")
+		require.Equal(t, "nick "+member.ID, member.Nickname)
+	}
+
+	require.Equal(t, 1, api.requests()["GET /guilds/1/roles"])
+	require.Equal(t, 1, api.requests()["GET /guilds/1/members"])
+}
+
+func TestDiscordErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	api.fail("/guilds/1/members/13/roles/101", http.StatusNotFound)
+	api.fail("/guilds/1/members/14/roles/101", http.StatusServiceUnavailable)
+
+	provider := delta.Provider{
+		Discord: delta.NewDiscordSession(testGuildID, api.session()),
+	}
+
+	err := provider.Apply(context.Background(), zap.NewNop(), delta.DeltaUserAddRole{UserID: "13", RoleName: "core"})
+	require.Error(t, err)
+	require.False(t, governance.IsRetryable(err), "unknown member should be permanent")
+
+	err = provider.Apply(context.Background(), zap.NewNop(), delta.DeltaUserAddRole{UserID: "14", RoleName: "core"})
+	require.Error(t, err)
+	require.True(t, governance.IsRetryable(err), "server error should be retryable")
+
+	err = provider.Apply(context.Background(), zap.NewNop(), delta.DeltaUserAddRole{UserID: "10", RoleName: "core"})
+	require.NoError(t, err)
+}
+
+// fakeAPI serves just enough of the Discord API to manage member roles.
+type fakeAPI struct {
+	server *httptest.Server
+
+	lock     sync.Mutex
+	counts   map[string]int
+	statuses map[string]int
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{
+		counts:   map[string]int{},
+		statuses: map[string]int{},
+	}
+
+	roles := []map[string]interface{}{
+		{"id": "1", "name": "@everyone", "permissions": "0", "position": 0},
+		{"id": "101", "name": "core", "permissions": "0", "position": 2},
+		{"id": "102", "name": "k8s", "permissions": "0", "position": 1},
+	}
+
+	members := []map[string]interface{}{
+		{"user": map[string]string{"id": "10", "username": "alice", "discriminator": "0001"}, "roles": []string{"102"}},
+		{"user": map[string]string{"id": "11", "username": "bob", "discriminator": "0002"}, "roles": []string{}},
+		{"user": map[string]string{"id": "12", "username": "carol", "discriminator": "0003"}, "roles": []string{"102"}},
+	}
+
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v"+discordgo.APIVersion)
+
+		api.lock.Lock()
+		api.counts[r.Method+" "+path]++
+		status, failing := api.statuses[path]
+		api.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case failing:
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "message": http.StatusText(status)})
+		case r.Method == "GET" && path == "/guilds/1/roles":
+			_ = json.NewEncoder(w).Encode(roles)
+		case r.Method == "GET" && path == "/guilds/1/members":
+			_ = json.NewEncoder(w).Encode(members)
+		case r.Method == "PATCH" && strings.HasPrefix(path, "/guilds/1/members/"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+		case strings.HasPrefix(path, "/guilds/1/members/"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(api.server.Close)
+
+	return api
+}
+
+// session sends every request to the fake API instead of Discord.
+func (api *fakeAPI) session() *discordgo.Session {
+	session, _ := discordgo.New("Bot token")
+
+	target, _ := url.Parse(api.server.URL)
+	session.Client = &http.Client{
+		Transport: rewriteHost{target},
+	}
+
+	return session
+}
+
+// fail responds to every request for the path with the status.
+func (api *fakeAPI) fail(path string, status int) {
+	api.lock.Lock()
+	api.statuses[path] = status
+	api.lock.Unlock()
+}
+
+func (api *fakeAPI) requests() map[string]int {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	counts := map[string]int{}
+	for req, count := range api.counts {
+		counts[req] = count
+	}
+
+	return counts
+}
+
+type rewriteHost struct {
+	target *url.URL
+}
+
+func (rewrite rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rewrite.target.Scheme
+	req.URL.Host = rewrite.target.Host
+
+	return http.DefaultTransport.RoundTrip(req)
+}
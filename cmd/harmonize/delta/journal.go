@@ -0,0 +1,547 @@
+package delta
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/concourse/governance"
+)
+
+// Journal is an append-only record of every change made to Discord, one JSON
+// entry per line, so that a run can be reviewed or rolled back.
+type Journal struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// NewRunID returns a unique, sortable ID for the changes made by one run.
+func NewRunID() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// JournalEntry records a single applied delta along with the state of
+// whatever it changed, before and after.
+type JournalEntry struct {
+	Time   time.Time
+	RunID  string
+	Delta  Delta
+	Before JournalState
+	After  JournalState
+
+	// Err is the reason the delta failed, if it did.
+	Err string
+}
+
+// JournalState is the part of the server a delta changed. Only the fields
+// relevant to the delta are set.
+type JournalState struct {
+	Role    *DiscordRole    `json:"role,omitempty"`
+	Roles   []DiscordRole   `json:"roles,omitempty"`
+	Member  *DiscordMember  `json:"member,omitempty"`
+	Channel *JournalChannel `json:"channel,omitempty"`
+
+	// Holders are the members who had a deleted role.
+	Holders []DiscordMember `json:"holders,omitempty"`
+}
+
+// JournalChannel is a channel along with the names its deltas refer to.
+type JournalChannel struct {
+	DiscordChannel
+
+	Category string `json:"category,omitempty"`
+
+	// RoleName is the role the channel is private to, if any.
+	RoleName string `json:"role_name,omitempty"`
+}
+
+type journalEntryJSON struct {
+	Time   time.Time       `json:"time"`
+	RunID  string          `json:"run_id"`
+	Type   string          `json:"type"`
+	Delta  json.RawMessage `json:"delta"`
+	Before JournalState    `json:"before"`
+	After  JournalState    `json:"after"`
+	Result string          `json:"result"`
+	Error  string          `json:"error,omitempty"`
+}
+
+const (
+	resultApplied = "applied"
+	resultFailed  = "failed"
+)
+
+func (entry JournalEntry) MarshalJSON() ([]byte, error) {
+	encoded, err := encodeDelta(entry.Delta)
+	if err != nil {
+		return nil, err
+	}
+
+	out := journalEntryJSON{
+		Time:   entry.Time,
+		RunID:  entry.RunID,
+		Type:   encoded.Type,
+		Delta:  encoded.Delta,
+		Before: entry.Before,
+		After:  entry.After,
+		Result: resultApplied,
+		Error:  entry.Err,
+	}
+
+	if entry.Err != "" {
+		out.Result = resultFailed
+	}
+
+	return json.Marshal(out)
+}
+
+func (entry *JournalEntry) UnmarshalJSON(payload []byte) error {
+	var in journalEntryJSON
+	err := json.Unmarshal(payload, &in)
+	if err != nil {
+		return err
+	}
+
+	delta, err := decodeDelta(deltaJSON{Type: in.Type, Delta: in.Delta})
+	if err != nil {
+		return err
+	}
+
+	*entry = JournalEntry{
+		Time:   in.Time,
+		RunID:  in.RunID,
+		Delta:  delta,
+		Before: in.Before,
+		After:  in.After,
+		Err:    in.Error,
+	}
+
+	return nil
+}
+
+// Record appends the entry to the journal.
+func (journal *Journal) Record(entry JournalEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	_, err = journal.w.Write(append(payload, '\n'))
+	return err
+}
+
+// ReadJournal returns the entries recorded by the run, in the order they were
+// applied.
+func ReadJournal(r io.Reader, runID string) ([]JournalEntry, error) {
+	decoder := json.NewDecoder(r)
+
+	var entries []JournalEntry
+	for line := 1; ; line++ {
+		var entry JournalEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", line, err)
+		}
+
+		if entry.RunID == runID {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Journaled records every change made through Discord to the Journal.
+// Reads are passed through.
+type Journaled struct {
+	Discord
+
+	Journal *Journal
+	RunID   string
+}
+
+func (journaled Journaled) CreateRole(delta DeltaRoleCreate) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Role: journaled.role("", delta.RoleName)}
+	}, func() error {
+		return journaled.Discord.CreateRole(delta)
+	})
+}
+
+func (journaled Journaled) EditRole(delta DeltaRoleEdit) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Role: journaled.role(delta.RoleID, "")}
+	}, func() error {
+		return journaled.Discord.EditRole(delta)
+	})
+}
+
+func (journaled Journaled) DeleteRole(delta DeltaRoleDelete) error {
+	return journaled.record(delta, func() JournalState {
+		state := JournalState{Role: journaled.role(delta.RoleID, "")}
+		if state.Role != nil {
+			state.Holders = journaled.holders(state.Role.Name)
+		}
+
+		return state
+	}, func() error {
+		return journaled.Discord.DeleteRole(delta)
+	})
+}
+
+func (journaled Journaled) SetRolePositions(delta DeltaRolePositions) error {
+	return journaled.record(delta, func() JournalState {
+		var roles []DiscordRole
+		for _, name := range delta {
+			role := journaled.role("", name)
+			if role != nil {
+				roles = append(roles, *role)
+			}
+		}
+
+		return JournalState{Roles: roles}
+	}, func() error {
+		return journaled.Discord.SetRolePositions(delta)
+	})
+}
+
+func (journaled Journaled) CreateChannel(delta DeltaChannelCreate) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Channel: journaled.channel("", delta.Name, delta.Type)}
+	}, func() error {
+		return journaled.Discord.CreateChannel(delta)
+	})
+}
+
+func (journaled Journaled) EditChannel(delta DeltaChannelEdit) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Channel: journaled.channel(delta.ChannelID, "", "")}
+	}, func() error {
+		return journaled.Discord.EditChannel(delta)
+	})
+}
+
+func (journaled Journaled) DeleteChannel(delta DeltaChannelDelete) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Channel: journaled.channel(delta.ChannelID, "", "")}
+	}, func() error {
+		return journaled.Discord.DeleteChannel(delta)
+	})
+}
+
+func (journaled Journaled) AddUserRole(delta DeltaUserAddRole) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Member: journaled.member(delta.UserID)}
+	}, func() error {
+		return journaled.Discord.AddUserRole(delta)
+	})
+}
+
+func (journaled Journaled) RemoveUserRole(delta DeltaUserRemoveRole) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Member: journaled.member(delta.UserID)}
+	}, func() error {
+		return journaled.Discord.RemoveUserRole(delta)
+	})
+}
+
+func (journaled Journaled) SetNickname(delta DeltaUserNickname) error {
+	return journaled.record(delta, func() JournalState {
+		return JournalState{Member: journaled.member(delta.UserID)}
+	}, func() error {
+		return journaled.Discord.SetNickname(delta)
+	})
+}
+
+// record snapshots the state before and after applying the delta. The
+// snapshots are best-effort; a change isn't held up by failing to read them.
+func (journaled Journaled) record(delta Delta, snapshot func() JournalState, apply func() error) error {
+	entry := JournalEntry{
+		RunID:  journaled.RunID,
+		Delta:  delta,
+		Before: snapshot(),
+	}
+
+	err := apply()
+	if err != nil {
+		entry.Err = err.Error()
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.After = snapshot()
+
+	recordErr := journaled.Journal.Record(entry)
+	if recordErr != nil {
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("applied, but failed to write journal: %w", recordErr)
+	}
+
+	return err
+}
+
+func (journaled Journaled) role(id, name string) *DiscordRole {
+	roles, err := journaled.Roles()
+	if err != nil {
+		return nil
+	}
+
+	role, found := findRole(roles, id, name)
+	if !found {
+		return nil
+	}
+
+	return &role
+}
+
+func (journaled Journaled) holders(roleName string) []DiscordMember {
+	members, err := journaled.Members()
+	if err != nil {
+		return nil
+	}
+
+	var holders []DiscordMember
+	for _, member := range members {
+		for _, name := range member.RoleNames {
+			if name == roleName {
+				holders = append(holders, member)
+				break
+			}
+		}
+	}
+
+	return holders
+}
+
+func (journaled Journaled) member(userID string) *DiscordMember {
+	members, err := journaled.Members()
+	if err != nil {
+		return nil
+	}
+
+	for _, member := range members {
+		if member.ID == userID {
+			return &member
+		}
+	}
+
+	return nil
+}
+
+// channel finds a channel by ID, if given, falling back to its name and type.
+func (journaled Journaled) channel(id, name string, channelType governance.DiscordChannelType) *JournalChannel {
+	channels, err := journaled.Channels()
+	if err != nil {
+		return nil
+	}
+
+	roles, err := journaled.Roles()
+	if err != nil {
+		return nil
+	}
+
+	for _, channel := range channels {
+		if id != "" && channel.ID != id {
+			continue
+		}
+
+		if id == "" && (channel.Name != name || channel.Type != channelType) {
+			continue
+		}
+
+		return journalChannel(channel, channels, roles)
+	}
+
+	return nil
+}
+
+func journalChannel(channel DiscordChannel, channels []DiscordChannel, roles []DiscordRole) *JournalChannel {
+	journalChannel := &JournalChannel{DiscordChannel: channel}
+
+	for _, parent := range channels {
+		if parent.ID == channel.ParentID {
+			journalChannel.Category = parent.Name
+		}
+	}
+
+	everyone, found := findRole(roles, "", everyoneRole)
+	if !found {
+		return journalChannel
+	}
+
+	for _, role := range roles {
+		if role.ID != everyone.ID && privateTo(channel, role.ID, everyone.ID) {
+			journalChannel.RoleName = role.Name
+		}
+	}
+
+	return journalChannel
+}
+
+// Rollback computes the deltas which undo the journaled changes, most recent
+// first. Failed changes are skipped. Changes which can't be undone, e.g. a
+// channel made private which was public before, are returned separately.
+func Rollback(entries []JournalEntry) ([]Delta, []JournalEntry) {
+	var deltas []Delta
+	var irreversible []JournalEntry
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Err != "" {
+			continue
+		}
+
+		inverse, ok := invert(entry)
+		if !ok {
+			irreversible = append(irreversible, entry)
+			continue
+		}
+
+		deltas = append(deltas, inverse...)
+	}
+
+	return deltas, irreversible
+}
+
+func invert(entry JournalEntry) ([]Delta, bool) {
+	before, after := entry.Before, entry.After
+
+	switch d := entry.Delta.(type) {
+	case DeltaRoleCreate:
+		if after.Role == nil {
+			return nil, false
+		}
+
+		return []Delta{DeltaRoleDelete{RoleID: after.Role.ID, RoleName: after.Role.Name}}, true
+
+	case DeltaRoleEdit:
+		if before.Role == nil {
+			return nil, false
+		}
+
+		return []Delta{DeltaRoleEdit{
+			RoleID:      before.Role.ID,
+			RoleName:    before.Role.Name,
+			OldName:     d.RoleName,
+			Color:       before.Role.Color,
+			Permissions: before.Role.Permissions,
+			Hoist:       before.Role.Hoist,
+			Mentionable: before.Role.Mentionable,
+			Emoji:       before.Role.Emoji,
+		}}, true
+
+	case DeltaRoleDelete:
+		if before.Role == nil {
+			return nil, false
+		}
+
+		deltas := []Delta{DeltaRoleCreate{
+			RoleName:    before.Role.Name,
+			Color:       before.Role.Color,
+			Permissions: before.Role.Permissions,
+			Hoist:       before.Role.Hoist,
+			Mentionable: before.Role.Mentionable,
+			Emoji:       before.Role.Emoji,
+		}}
+
+		for _, member := range before.Holders {
+			deltas = append(deltas, DeltaUserAddRole{
+				UserID:   member.ID,
+				UserName: member.Name,
+				RoleName: before.Role.Name,
+			})
+		}
+
+		return deltas, true
+
+	case DeltaRolePositions:
+		if len(before.Roles) != len(d) {
+			return nil, false
+		}
+
+		roles := append([]DiscordRole{}, before.Roles...)
+		sort.Sort(byPosition(roles))
+
+		var order DeltaRolePositions
+		for _, role := range roles {
+			order = append(order, role.Name)
+		}
+
+		return []Delta{order}, true
+
+	case DeltaChannelCreate:
+		if after.Channel == nil {
+			return nil, false
+		}
+
+		return []Delta{DeltaChannelDelete{ChannelID: after.Channel.ID, Name: after.Channel.Name}}, true
+
+	case DeltaChannelEdit:
+		if before.Channel == nil || before.Channel.RoleName == "" {
+			return nil, false
+		}
+
+		return []Delta{DeltaChannelEdit{
+			ChannelID: before.Channel.ID,
+			Name:      before.Channel.Name,
+			Type:      before.Channel.Type,
+			Topic:     before.Channel.Topic,
+			Category:  before.Channel.Category,
+			RoleName:  before.Channel.RoleName,
+		}}, true
+
+	case DeltaChannelDelete:
+		if before.Channel == nil || before.Channel.RoleName == "" {
+			return nil, false
+		}
+
+		return []Delta{DeltaChannelCreate{
+			Name:     before.Channel.Name,
+			Type:     before.Channel.Type,
+			Topic:    before.Channel.Topic,
+			Category: before.Channel.Category,
+			RoleName: before.Channel.RoleName,
+		}}, true
+
+	case DeltaUserAddRole:
+		return []Delta{DeltaUserRemoveRole(d)}, true
+
+	case DeltaUserRemoveRole:
+		return []Delta{DeltaUserAddRole(d)}, true
+
+	case DeltaUserNickname:
+		if before.Member == nil {
+			return nil, false
+		}
+
+		return []Delta{DeltaUserNickname{
+			UserID:   d.UserID,
+			UserName: d.UserName,
+			Nickname: before.Member.Nickname,
+		}}, true
+	}
+
+	return nil, false
+}
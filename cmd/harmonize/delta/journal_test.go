@@ -0,0 +1,108 @@
+package delta_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/delta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	discord := fakeDiscord{
+		members: []delta.DiscordMember{
+			{ID: "alice-id", Name: "alice#1234", Nickname: "al", RoleNames: []string{"core"}},
+			{ID: "bob-id", Name: "bob#5678"},
+		},
+		roles: []delta.DiscordRole{
+			{ID: "everyone-id", Name: "@everyone"},
+			{ID: "core-id", Name: "core", Color: 0xff0000, Permissions: 8, Position: 2},
+			{ID: "k8s-id", Name: "k8s", Position: 1},
+		},
+		channels: []delta.DiscordChannel{
+			{ID: "cat-id", Name: "core", Type: governance.DiscordChannelCategory},
+			{
+				ID:       "chat-id",
+				Name:     "chat",
+				Type:     governance.DiscordChannelText,
+				ParentID: "cat-id",
+				Overwrites: []delta.DiscordOverwrite{
+					{RoleID: "everyone-id", Deny: governance.DiscordPermissions["VIEW_CHANNEL"]},
+					{RoleID: "core-id", Allow: governance.DiscordPermissions["VIEW_CHANNEL"]},
+				},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	journal := delta.NewJournal(buf)
+
+	other := delta.Journaled{Discord: discord, Journal: journal, RunID: "other-run"}
+	require.NoError(t, other.AddUserRole(delta.DeltaUserAddRole{UserID: "bob-id", UserName: "bob#5678", RoleName: "k8s"}))
+
+	journaled := delta.Journaled{Discord: discord, Journal: journal, RunID: "run"}
+	require.NoError(t, journaled.AddUserRole(delta.DeltaUserAddRole{UserID: "bob-id", UserName: "bob#5678", RoleName: "core"}))
+	require.NoError(t, journaled.RemoveUserRole(delta.DeltaUserRemoveRole{UserID: "alice-id", UserName: "alice#1234", RoleName: "core"}))
+	require.NoError(t, journaled.EditRole(delta.DeltaRoleEdit{RoleID: "core-id", RoleName: "core", Color: 0x00ff00}))
+	require.NoError(t, journaled.DeleteRole(delta.DeltaRoleDelete{RoleID: "core-id", RoleName: "core"}))
+	require.NoError(t, journaled.SetRolePositions(delta.DeltaRolePositions{"core", "k8s"}))
+	require.NoError(t, journaled.SetNickname(delta.DeltaUserNickname{UserID: "alice-id", UserName: "alice#1234", Nickname: "Alice"}))
+	require.NoError(t, journaled.EditChannel(delta.DeltaChannelEdit{ChannelID: "chat-id", Name: "general", Type: governance.DiscordChannelText, RoleName: "k8s"}))
+
+	failing := delta.Journaled{
+		Discord: fakeDiscord{nicknameErr: errors.New("missing permissions")},
+		Journal: journal,
+		RunID:   "run",
+	}
+	require.Error(t, failing.SetNickname(delta.DeltaUserNickname{UserID: "bob-id", Nickname: "Bob"}))
+
+	entries, err := delta.ReadJournal(bytes.NewReader(buf.Bytes()), "run")
+	require.NoError(t, err)
+	require.Len(t, entries, 8)
+
+	require.Equal(t, delta.DeltaUserAddRole{UserID: "bob-id", UserName: "bob#5678", RoleName: "core"}, entries[0].Delta)
+	require.Equal(t, &discord.members[1], entries[0].Before.Member)
+	require.NotZero(t, entries[0].Time)
+	require.Equal(t, "missing permissions", entries[7].Err)
+
+	deltas, irreversible := delta.Rollback(entries)
+	require.Empty(t, irreversible)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaChannelEdit{ChannelID: "chat-id", Name: "chat", Type: governance.DiscordChannelText, Category: "core", RoleName: "core"},
+		delta.DeltaUserNickname{UserID: "alice-id", UserName: "alice#1234", Nickname: "al"},
+		delta.DeltaRolePositions{"k8s", "core"},
+		delta.DeltaRoleCreate{RoleName: "core", Color: 0xff0000, Permissions: 8},
+		delta.DeltaUserAddRole{UserID: "alice-id", UserName: "alice#1234", RoleName: "core"},
+		delta.DeltaRoleEdit{RoleID: "core-id", RoleName: "core", OldName: "core", Color: 0xff0000, Permissions: 8},
+		delta.DeltaUserAddRole{UserID: "alice-id", UserName: "alice#1234", RoleName: "core"},
+		delta.DeltaUserRemoveRole{UserID: "bob-id", UserName: "bob#5678", RoleName: "core"},
+	}, deltas)
+}
+
+func TestRollbackIrreversible(t *testing.T) {
+	public := delta.JournalEntry{
+		RunID: "run",
+		Delta: delta.DeltaChannelEdit{ChannelID: "chat-id", Name: "chat", RoleName: "core"},
+		Before: delta.JournalState{
+			Channel: &delta.JournalChannel{
+				DiscordChannel: delta.DiscordChannel{ID: "chat-id", Name: "lobby"},
+			},
+		},
+	}
+
+	created := delta.JournalEntry{
+		RunID: "run",
+		Delta: delta.DeltaChannelCreate{Name: "chat", Type: governance.DiscordChannelText, RoleName: "core"},
+		After: delta.JournalState{
+			Channel: &delta.JournalChannel{
+				DiscordChannel: delta.DiscordChannel{ID: "chat-id", Name: "chat"},
+			},
+		},
+	}
+
+	deltas, irreversible := delta.Rollback([]delta.JournalEntry{created, public})
+	require.Equal(t, []delta.Delta{delta.DeltaChannelDelete{ChannelID: "chat-id", Name: "chat"}}, deltas)
+	require.Equal(t, []delta.JournalEntry{public}, irreversible)
+}
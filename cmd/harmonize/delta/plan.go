@@ -0,0 +1,323 @@
+package delta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/concourse/governance"
+)
+
+// Plan is a reviewable set of deltas, along with a snapshot of the state they
+// were computed against so that they aren't applied to a server that has
+// since changed.
+type Plan struct {
+	GuildID  string
+	Snapshot string
+	Deltas   []Delta
+}
+
+func NewPlan(guildID string, config *governance.Config, state State, deltas []Delta) (Plan, error) {
+	snapshot, err := state.Hash(config)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	return Plan{
+		GuildID:  guildID,
+		Snapshot: snapshot,
+		Deltas:   deltas,
+	}, nil
+}
+
+// deltaTypes maps each delta type to the tag it's serialized with. Every
+// Delta must be listed here to be planned.
+var deltaTypes = map[string]reflect.Type{
+	"role_create":      reflect.TypeOf(DeltaRoleCreate{}),
+	"role_edit":        reflect.TypeOf(DeltaRoleEdit{}),
+	"role_delete":      reflect.TypeOf(DeltaRoleDelete{}),
+	"role_positions":   reflect.TypeOf(DeltaRolePositions{}),
+	"channel_create":   reflect.TypeOf(DeltaChannelCreate{}),
+	"channel_edit":     reflect.TypeOf(DeltaChannelEdit{}),
+	"channel_delete":   reflect.TypeOf(DeltaChannelDelete{}),
+	"user_add_role":    reflect.TypeOf(DeltaUserAddRole{}),
+	"user_remove_role": reflect.TypeOf(DeltaUserRemoveRole{}),
+	"user_nickname":    reflect.TypeOf(DeltaUserNickname{}),
+}
+
+type planJSON struct {
+	GuildID  string      `json:"guild_id"`
+	Snapshot string      `json:"snapshot"`
+	Deltas   []deltaJSON `json:"deltas"`
+}
+
+type deltaJSON struct {
+	Type  string          `json:"type"`
+	Delta json.RawMessage `json:"delta"`
+}
+
+func (plan Plan) MarshalJSON() ([]byte, error) {
+	out := planJSON{
+		GuildID:  plan.GuildID,
+		Snapshot: plan.Snapshot,
+		Deltas:   []deltaJSON{},
+	}
+
+	for _, delta := range plan.Deltas {
+		encoded, err := encodeDelta(delta)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Deltas = append(out.Deltas, encoded)
+	}
+
+	return json.Marshal(out)
+}
+
+func (plan *Plan) UnmarshalJSON(payload []byte) error {
+	var in planJSON
+	err := json.Unmarshal(payload, &in)
+	if err != nil {
+		return err
+	}
+
+	plan.GuildID = in.GuildID
+	plan.Snapshot = in.Snapshot
+	plan.Deltas = nil
+
+	for i, d := range in.Deltas {
+		delta, err := decodeDelta(d)
+		if err != nil {
+			return fmt.Errorf("delta %d: %w", i, err)
+		}
+
+		plan.Deltas = append(plan.Deltas, delta)
+	}
+
+	return nil
+}
+
+func encodeDelta(delta Delta) (deltaJSON, error) {
+	tag, err := deltaTag(delta)
+	if err != nil {
+		return deltaJSON{}, err
+	}
+
+	payload, err := json.Marshal(delta)
+	if err != nil {
+		return deltaJSON{}, fmt.Errorf("marshal %s: %w", tag, err)
+	}
+
+	return deltaJSON{
+		Type:  tag,
+		Delta: payload,
+	}, nil
+}
+
+func decodeDelta(d deltaJSON) (Delta, error) {
+	deltaType, found := deltaTypes[d.Type]
+	if !found {
+		return nil, fmt.Errorf("unknown type %q", d.Type)
+	}
+
+	val := reflect.New(deltaType)
+	err := json.Unmarshal(d.Delta, val.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.Type, err)
+	}
+
+	return val.Elem().Interface().(Delta), nil
+}
+
+func deltaTag(delta Delta) (string, error) {
+	for tag, deltaType := range deltaTypes {
+		if reflect.TypeOf(delta) == deltaType {
+			return tag, nil
+		}
+	}
+
+	return "", fmt.Errorf("delta type %T cannot be planned", delta)
+}
+
+// Hash returns a digest of the parts of the state managed by the config,
+// independent of the order they were listed in. Changes elsewhere, e.g. an
+// unrelated member joining or changing their name, don't affect it.
+func (state State) Hash(config *governance.Config) (string, error) {
+	contributors := state.contributors(config)
+	managed := state.managed(config, contributors)
+
+	members := make([]DiscordMember, len(managed.Members))
+	for i, member := range managed.Members {
+		member.RoleNames = append([]string{}, member.RoleNames...)
+		sort.Strings(member.RoleNames)
+		members[i] = member
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+
+	roles := append([]DiscordRole{}, managed.Roles...)
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+
+	channels := make([]DiscordChannel, len(managed.Channels))
+	for i, channel := range managed.Channels {
+		channel.Overwrites = append([]DiscordOverwrite{}, channel.Overwrites...)
+		sort.Slice(channel.Overwrites, func(i, j int) bool {
+			return channel.Overwrites[i].RoleID < channel.Overwrites[j].RoleID
+		})
+		channels[i] = channel
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].ID < channels[j].ID
+	})
+
+	payload, err := json.Marshal(struct {
+		State
+
+		// which member each contributor resolved to, as a member changing
+		// their name can change who is granted a role
+		Contributors map[string]string
+	}{
+		State: State{
+			Guild:    managed.Guild,
+			Members:  members,
+			Roles:    roles,
+			Channels: channels,
+		},
+		Contributors: contributors,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal state: %w", err)
+	}
+
+	sum := sha256.Sum256(payload)
+
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// managed returns the subset of the state that the config's deltas depend on:
+// the roles of current and retired teams, the teams' categories and channels,
+// and the members who are contributors or hold a team's role. Members are
+// reduced to their ID, roles, and nickname.
+func (state State) managed(config *governance.Config, contributors map[string]string) State {
+	roleIDs := map[string]bool{}
+	roleNames := map[string]bool{everyoneRole: true}
+	categories := map[string]bool{}
+	for _, team := range config.Teams {
+		roleNames[teamRoleName(team)] = true
+
+		if team.Discord.RoleID != "" {
+			roleIDs[team.Discord.RoleID] = true
+		}
+
+		if len(team.Discord.Channels) > 0 {
+			categories[team.CategoryName()] = true
+		}
+	}
+
+	for _, role := range config.RetiredRoles {
+		roleIDs[role.ID] = true
+	}
+
+	managed := State{Guild: state.Guild}
+
+	for _, role := range state.Roles {
+		if roleIDs[role.ID] || roleNames[role.Name] {
+			managed.Roles = append(managed.Roles, role)
+
+			// members refer to roles by name, which may differ for a role found
+			// by ID
+			roleNames[role.Name] = true
+		}
+	}
+
+	categoryIDs := map[string]bool{}
+	for _, channel := range state.Channels {
+		if channel.Type == governance.DiscordChannelCategory && categories[channel.Name] {
+			categoryIDs[channel.ID] = true
+		}
+	}
+
+	for _, channel := range state.Channels {
+		if categoryIDs[channel.ID] || categoryIDs[channel.ParentID] {
+			managed.Channels = append(managed.Channels, channel)
+		}
+	}
+
+	contributorIDs := map[string]bool{}
+	for _, userID := range contributors {
+		contributorIDs[userID] = true
+	}
+
+	for _, member := range state.Members {
+		holdsManagedRole := false
+		for _, name := range member.RoleNames {
+			if roleNames[name] && name != everyoneRole {
+				holdsManagedRole = true
+			}
+		}
+
+		if !contributorIDs[member.ID] && !holdsManagedRole {
+			continue
+		}
+
+		managed.Members = append(managed.Members, DiscordMember{
+			ID:        member.ID,
+			Nickname:  member.Nickname,
+			RoleNames: member.RoleNames,
+		})
+	}
+
+	return managed
+}
+
+// contributors maps each contributor's Discord handle to the ID of the member
+// it resolves to.
+func (state State) contributors(config *governance.Config) map[string]string {
+	userIDs := indexMembers(state.Members)
+
+	contributors := map[string]string{}
+	for _, person := range config.Contributors {
+		if person.Discord == "" {
+			continue
+		}
+
+		if userID, found := userIDs.resolve(person.Discord); found {
+			contributors[person.Discord] = userID
+		}
+	}
+
+	return contributors
+}
+
+// ErrStalePlan is returned when applying a plan to a state other than the
+// one it was computed against.
+var ErrStalePlan = errors.New("state has changed since the plan was made")
+
+// Verify checks that the plan was made for the given guild and the state
+// managed by the config.
+func (plan Plan) Verify(guildID string, config *governance.Config, state State) error {
+	if plan.GuildID != guildID {
+		return fmt.Errorf("plan is for guild %s, not %s", plan.GuildID, guildID)
+	}
+
+	snapshot, err := state.Hash(config)
+	if err != nil {
+		return err
+	}
+
+	if plan.Snapshot != snapshot {
+		return ErrStalePlan
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package delta_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/delta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRoundTrip(t *testing.T) {
+	state := delta.State{
+		Members: syncedMembers,
+		Roles:   syncedRoles,
+	}
+
+	plan, err := delta.NewPlan("some-guild", config, state, []delta.Delta{
+		delta.DeltaRoleCreate{RoleName: "new-team", Color: 0x123456, Permissions: basePermissions},
+		delta.DeltaRoleEdit{RoleID: "banana-team-id", RoleName: "banana-team", Color: 0x654321, Permissions: basePermissions},
+		delta.DeltaRolePositions{"all", "banana-team", "admin-team", "new-team"},
+		delta.DeltaUserAddRole{UserID: "potato-id", UserName: "potato#456", RoleName: "new-team"},
+		delta.DeltaUserRemoveRole{UserID: "potato-id", UserName: "potato#456", RoleName: "banana-team"},
+	})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(plan)
+	require.NoError(t, err)
+
+	var tags struct {
+		Deltas []struct {
+			Type string `json:"type"`
+		} `json:"deltas"`
+	}
+	err = json.Unmarshal(payload, &tags)
+	require.NoError(t, err)
+	require.Len(t, tags.Deltas, 5)
+	require.Equal(t, "role_create", tags.Deltas[0].Type)
+	require.Equal(t, "user_remove_role", tags.Deltas[4].Type)
+
+	var decoded delta.Plan
+	err = json.Unmarshal(payload, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, plan, decoded)
+
+	require.NoError(t, decoded.Verify("some-guild", config, state))
+}
+
+func TestPlanUnknownType(t *testing.T) {
+	var plan delta.Plan
+	err := json.Unmarshal([]byte(`{"deltas":[{"type":"bogus","delta":{}}]}`), &plan)
+	require.EqualError(t, err, `delta 0: unknown type "bogus"`)
+}
+
+func TestPlanVerify(t *testing.T) {
+	state := delta.State{
+		Members: syncedMembers,
+		Roles:   syncedRoles,
+	}
+
+	plan, err := delta.NewPlan("some-guild", config, state, nil)
+	require.NoError(t, err)
+
+	t.Run("ignores ordering", func(t *testing.T) {
+		reordered := delta.State{
+			Members: []delta.DiscordMember{
+				{
+					ID:        "potato-id",
+					Name:      "potato#456",
+					RoleNames: []string{"all", "banana-team"},
+				},
+				syncedMembers[0],
+			},
+			Roles: []delta.DiscordRole{syncedRoles[2], syncedRoles[0], syncedRoles[1]},
+		}
+
+		require.NoError(t, plan.Verify("some-guild", config, reordered))
+	})
+
+	t.Run("ignores unmanaged changes", func(t *testing.T) {
+		unrelated := delta.State{
+			Members: append(append([]delta.DiscordMember{}, syncedMembers...), delta.DiscordMember{
+				ID:        "stranger-id",
+				Name:      "stranger#000",
+				RoleNames: []string{"moderators"},
+			}),
+			Roles: append([]delta.DiscordRole{
+				{ID: "moderators-id", Name: "moderators", Position: 4},
+			}, syncedRoles...),
+			Channels: []delta.DiscordChannel{
+				{ID: "lobby-id", Name: "lobby", Type: governance.DiscordChannelText},
+			},
+		}
+
+		require.NoError(t, plan.Verify("some-guild", config, unrelated))
+	})
+
+	t.Run("rejects a changed state", func(t *testing.T) {
+		changed := delta.State{
+			Members: syncedMembers[:1],
+			Roles:   syncedRoles,
+		}
+
+		require.Equal(t, delta.ErrStalePlan, plan.Verify("some-guild", config, changed))
+	})
+
+	t.Run("rejects a contributor resolving to someone else", func(t *testing.T) {
+		renamed := append([]delta.DiscordMember{}, syncedMembers...)
+		renamed[0].Name = "andrew#999"
+
+		changed := delta.State{
+			Members: renamed,
+			Roles:   syncedRoles,
+		}
+
+		require.Equal(t, delta.ErrStalePlan, plan.Verify("some-guild", config, changed))
+	})
+
+	t.Run("rejects a changed nickname", func(t *testing.T) {
+		renamed := append([]delta.DiscordMember{}, syncedMembers...)
+		renamed[0].Nickname = "Andrew"
+
+		changed := delta.State{
+			Members: renamed,
+			Roles:   syncedRoles,
+		}
+
+		require.Equal(t, delta.ErrStalePlan, plan.Verify("some-guild", config, changed))
+	})
+
+	t.Run("rejects another guild", func(t *testing.T) {
+		require.Error(t, plan.Verify("other-guild", config, state))
+	})
+}
@@ -0,0 +1,123 @@
+package delta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/concourse/governance"
+	"go.uber.org/zap"
+)
+
+// Provider synchronizes Discord roles as a governance.Provider. The desired
+// state is the config itself.
+type Provider struct {
+	Discord Discord
+
+	// Logger is warned about contributors who can't be found on the server.
+	// Defaults to a no-op logger.
+	Logger *zap.Logger
+
+	// Nicknames enables setting contributors' nicknames to their names.
+	Nicknames bool
+}
+
+func (provider Provider) Name() string {
+	return "discord"
+}
+
+func (provider Provider) Load(context.Context) (governance.ProviderState, error) {
+	return LoadState(provider.Discord)
+}
+
+func (provider Provider) Desired(config *governance.Config) (governance.ProviderState, error) {
+	return config, nil
+}
+
+func (provider Provider) Diff(desired, actual governance.ProviderState) ([]governance.ProviderDelta, error) {
+	config, ok := desired.(*governance.Config)
+	if !ok {
+		return nil, fmt.Errorf("unexpected desired state: %T", desired)
+	}
+
+	state, ok := actual.(State)
+	if !ok {
+		return nil, fmt.Errorf("unexpected actual state: %T", actual)
+	}
+
+	if provider.Logger != nil {
+		WarnUnresolved(provider.Logger, config, state)
+	}
+
+	deltas, err := DiffState(config, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Nicknames {
+		nicknames, unrenamable := DiffNicknames(config, state)
+		deltas = append(deltas, nicknames...)
+
+		if provider.Logger != nil {
+			WarnUnrenamable(provider.Logger, unrenamable)
+		}
+	}
+
+	providerDeltas := make([]governance.ProviderDelta, len(deltas))
+	for i, delta := range deltas {
+		providerDeltas[i] = delta
+	}
+
+	return providerDeltas, nil
+}
+
+func (provider Provider) Apply(_ context.Context, logger *zap.Logger, providerDelta governance.ProviderDelta) error {
+	delta, ok := providerDelta.(Delta)
+	if !ok {
+		return fmt.Errorf("unexpected delta: %T", providerDelta)
+	}
+
+	return classify(delta.Apply(logger, provider.Discord))
+}
+
+// classify marks rate limits, server errors, and timeouts as retryable.
+// Anything else, e.g. an unknown member who left mid-run, is permanent.
+func classify(err error) error {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		status := restErr.Response.StatusCode
+		if status == http.StatusTooManyRequests || status >= 500 {
+			return governance.Retryable(err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return governance.Retryable(err)
+	}
+
+	return err
+}
+
+// WarnUnresolved logs each contributor who won't be granted their roles
+// because they can't be found on the server.
+func WarnUnresolved(logger *zap.Logger, config *governance.Config, state State) {
+	for _, person := range Unresolved(config, state) {
+		logger.Warn("contributor not found on discord",
+			zap.String("contributor", person.Name),
+			zap.String("github", person.GitHub),
+			zap.String("discord", person.Discord))
+	}
+}
+
+// WarnUnrenamable logs each member whose nickname can't be set because of the
+// role hierarchy.
+func WarnUnrenamable(logger *zap.Logger, members []DiscordMember) {
+	for _, member := range members {
+		logger.Warn("cannot set nickname of member ranked at or above the bot",
+			zap.String("user", member.Name))
+	}
+}
@@ -0,0 +1,229 @@
+package delta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/concourse/governance"
+	"go.uber.org/zap"
+)
+
+// MemberEvent is sent when a member joins the server or their roles or name
+// change.
+type MemberEvent struct {
+	ID       string
+	Name     string
+	Username string
+	Nickname string
+	RoleIDs  []string
+}
+
+// WatchMembers connects to the gateway and sends an event for each member who
+// joins or changes. Events stop once the context is done.
+func WatchMembers(ctx context.Context, guildID, token string) (<-chan MemberEvent, error) {
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, fmt.Errorf("init discordgo: %w", err)
+	}
+
+	session.Identify.Intents = discordgo.IntentsGuildMembers
+
+	events := make(chan MemberEvent)
+
+	send := func(member *discordgo.Member) {
+		if member.GuildID != guildID || member.User == nil {
+			return
+		}
+
+		event := MemberEvent{
+			ID:       member.User.ID,
+			Name:     member.User.String(),
+			Username: member.User.Username,
+			Nickname: member.Nick,
+			RoleIDs:  member.Roles,
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	session.AddHandler(func(_ *discordgo.Session, event *discordgo.GuildMemberAdd) {
+		send(event.Member)
+	})
+
+	session.AddHandler(func(_ *discordgo.Session, event *discordgo.GuildMemberUpdate) {
+		send(event.Member)
+	})
+
+	err = session.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open gateway: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = session.Close()
+	}()
+
+	return events, nil
+}
+
+// ErrUnknownRole is returned for a member with a role that isn't in the
+// watcher's state, e.g. one created since the last full run.
+var ErrUnknownRole = errors.New("member has a role unknown to the watcher")
+
+// Watcher applies the deltas for individual members as they change, between
+// full runs.
+type Watcher struct {
+	Discord Discord
+	Logger  *zap.Logger
+
+	// Runner applies each member's deltas, subject to its BlastRadius and
+	// retries. Its providers and logger are ignored.
+	Runner governance.Runner
+
+	// Nicknames enables setting contributors' nicknames to their names.
+	Nicknames bool
+
+	lock    sync.Mutex
+	config  *governance.Config
+	state   State
+	members map[string]DiscordMember
+}
+
+// Reset replaces the config and state members are diffed against, e.g. after
+// a full run.
+func (watcher *Watcher) Reset(config *governance.Config, state State) {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	watcher.config = config
+	watcher.state = state
+
+	watcher.members = map[string]DiscordMember{}
+	for _, member := range state.Members {
+		watcher.members[member.ID] = member
+	}
+}
+
+// MemberChanged applies only the deltas affecting the member. Nothing is
+// applied until Reset has been called.
+func (watcher *Watcher) MemberChanged(ctx context.Context, event MemberEvent) error {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.config == nil {
+		return nil
+	}
+
+	roleNames := make([]string, len(event.RoleIDs))
+	for i, roleID := range event.RoleIDs {
+		role, found := findRole(watcher.state.Roles, roleID, "")
+		if !found {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, roleID)
+		}
+
+		roleNames[i] = role.Name
+	}
+
+	member := DiscordMember{
+		ID:        event.ID,
+		Name:      event.Name,
+		Username:  event.Username,
+		Nickname:  event.Nickname,
+		RoleNames: roleNames,
+	}
+
+	watcher.members[member.ID] = member
+
+	// only the member and the bot, whose roles limit who it can rename, are
+	// needed to diff the member
+	state := State{
+		Guild:   watcher.state.Guild,
+		Members: []DiscordMember{member},
+		Roles:   watcher.state.Roles,
+	}
+
+	if bot, found := watcher.members[state.Guild.BotID]; found && bot.ID != member.ID {
+		state.Members = append(state.Members, bot)
+	}
+
+	deltas, err := DiffMember(watcher.config, state, member.ID)
+	if err != nil {
+		return err
+	}
+
+	if watcher.Nicknames {
+		nicknames, _ := DiffNicknames(watcher.config, state)
+		deltas = append(deltas, forMember(nicknames, member.ID)...)
+	}
+
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	plan := governance.ProviderPlan{
+		Provider:   Provider{Discord: watcher.Discord},
+		Population: len(watcher.members),
+	}
+
+	for _, delta := range deltas {
+		plan.Deltas = append(plan.Deltas, delta)
+	}
+
+	logger := watcher.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	runner := watcher.Runner
+	runner.Logger = logger.With(zap.String("user", member.Name))
+
+	return runner.Apply(ctx, []governance.ProviderPlan{plan})
+}
+
+// DiffMember computes only the deltas affecting a single member's roles.
+// Deltas for roles that have yet to be created are left to the next full run.
+//
+// The state need only include the member, which is much cheaper to diff than
+// the whole server.
+func DiffMember(config *governance.Config, state State, userID string) ([]Delta, error) {
+	deltas, err := DiffState(config, state)
+	if err != nil {
+		return nil, err
+	}
+
+	existingRoles := map[string]bool{}
+	for _, role := range state.Roles {
+		existingRoles[role.Name] = true
+	}
+
+	var memberDeltas []Delta
+	for _, delta := range forMember(deltas, userID) {
+		if add, ok := delta.(DeltaUserAddRole); ok && !existingRoles[add.RoleName] {
+			continue
+		}
+
+		memberDeltas = append(memberDeltas, delta)
+	}
+
+	return memberDeltas, nil
+}
+
+func forMember(deltas []Delta, userID string) []Delta {
+	var memberDeltas []Delta
+	for _, delta := range deltas {
+		// member deltas are keyed by user ID
+		keyed, ok := delta.(governance.Concurrent)
+		if ok && keyed.ConcurrencyKey() == userID {
+			memberDeltas = append(memberDeltas, delta)
+		}
+	}
+
+	return memberDeltas
+}
@@ -0,0 +1,163 @@
+package delta_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/delta"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWatcher(t *testing.T) {
+	ctx := context.Background()
+
+	core, observed := observer.New(zapcore.InfoLevel)
+
+	watcher := &delta.Watcher{
+		Discord: fakeDiscord{},
+		Logger:  zap.New(core),
+	}
+
+	joined := delta.MemberEvent{
+		ID:   "onion-id",
+		Name: "onion#789",
+	}
+
+	// nothing to diff against yet
+	err := watcher.MemberChanged(ctx, joined)
+	require.NoError(t, err)
+	require.Zero(t, observed.Len())
+
+	state := delta.State{
+		Members: syncedMembers,
+		Roles:   syncedRoles,
+	}
+
+	watcher.Reset(config, state)
+
+	err = watcher.MemberChanged(ctx, joined)
+	require.NoError(t, err)
+
+	logs := observed.FilterMessageSnippet("user role").TakeAll()
+	observed.TakeAll()
+	require.Len(t, logs, 1)
+	require.Equal(t, "adding user role", logs[0].Message)
+	require.Equal(t, "all", logs[0].ContextMap()["role"])
+
+	// only the member's own deltas are applied, even if others have drifted
+	err = watcher.MemberChanged(ctx, delta.MemberEvent{
+		ID:      "potato-id",
+		Name:    "potato#456",
+		RoleIDs: []string{"all-team-id", "banana-team-id", "admin-team-id"},
+	})
+	require.NoError(t, err)
+
+	logs = observed.FilterMessageSnippet("user role").TakeAll()
+	observed.TakeAll()
+	require.Len(t, logs, 1)
+	require.Equal(t, "removing user role", logs[0].Message)
+	require.Equal(t, "admin-team", logs[0].ContextMap()["role"])
+
+	err = watcher.MemberChanged(ctx, delta.MemberEvent{
+		ID:      "andrew-id",
+		Name:    "andrew#123",
+		RoleIDs: []string{"brand-new-role-id"},
+	})
+	require.ErrorIs(t, err, delta.ErrUnknownRole)
+	require.Zero(t, observed.Len())
+}
+
+func TestWatcherRunner(t *testing.T) {
+	ctx := context.Background()
+
+	state := delta.State{
+		Members: syncedMembers,
+		Roles:   syncedRoles,
+	}
+
+	drifted := delta.MemberEvent{
+		ID:      "potato-id",
+		Name:    "potato#456",
+		RoleIDs: []string{"all-team-id", "banana-team-id", "admin-team-id"},
+	}
+
+	t.Run("respects the blast radius", func(t *testing.T) {
+		watcher := &delta.Watcher{
+			Discord: fakeDiscord{},
+			Runner: governance.Runner{
+				BlastRadius: governance.BlastRadius{MaxPercent: 10},
+			},
+		}
+
+		watcher.Reset(config, state)
+
+		err := watcher.MemberChanged(ctx, drifted)
+
+		var blastErr governance.BlastRadiusError
+		require.True(t, errors.As(err, &blastErr))
+	})
+
+	t.Run("returns every failure", func(t *testing.T) {
+		watcher := &delta.Watcher{
+			Discord:   fakeDiscord{nicknameErr: errors.New("missing permissions")},
+			Nicknames: true,
+		}
+
+		watcher.Reset(config, delta.State{
+			Guild: delta.DiscordGuild{BotID: "bot-id"},
+			Members: append([]delta.DiscordMember{
+				{ID: "bot-id", Name: "bot#000", RoleNames: []string{"bot"}},
+			}, syncedMembers...),
+			Roles: append([]delta.DiscordRole{
+				{ID: "bot-role-id", Name: "bot", Position: 10},
+			}, syncedRoles...),
+		})
+
+		err := watcher.MemberChanged(ctx, delta.MemberEvent{
+			ID:      "andrew-id",
+			Name:    "andrew#123",
+			RoleIDs: []string{"admin-team-id", "all-team-id"},
+		})
+
+		var applyErr governance.ApplyError
+		require.True(t, errors.As(err, &applyErr))
+		require.Len(t, applyErr.Failures, 1)
+		require.Equal(t, delta.DeltaUserNickname{UserID: "andrew-id", UserName: "andrew#123", Nickname: "andrew"}, applyErr.Failures[0].Delta)
+	})
+}
+
+func TestDiffMember(t *testing.T) {
+	// no roles exist yet, so there's nothing to do for the member until a full
+	// run creates them
+	diff, err := delta.DiffMember(config, delta.State{
+		Members: syncedMembers,
+	}, "andrew-id")
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	diff, err = delta.DiffMember(config, delta.State{
+		Members: []delta.DiscordMember{
+			{ID: "andrew-id", Name: "andrew#123"},
+			{ID: "potato-id", Name: "potato#456"},
+		},
+		Roles: syncedRoles,
+	}, "andrew-id")
+	require.NoError(t, err)
+	require.Equal(t, []delta.Delta{
+		delta.DeltaUserAddRole{
+			UserID:   "andrew-id",
+			UserName: "andrew#123",
+			RoleName: "admin-team",
+		},
+		delta.DeltaUserAddRole{
+			UserID:   "andrew-id",
+			UserName: "andrew#123",
+			RoleName: "all",
+		},
+	}, diff)
+}
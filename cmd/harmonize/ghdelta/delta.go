@@ -0,0 +1,299 @@
+package ghdelta
+
+import (
+	"github.com/concourse/governance"
+	"go.uber.org/zap"
+)
+
+type Delta interface {
+	Apply(*zap.Logger, GitHub) error
+}
+
+type DeltaRepoCreate struct {
+	Repo governance.GitHubRepo
+}
+
+func (delta DeltaRepoCreate) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("creating repo",
+		zap.String("repo", delta.Repo.Name))
+
+	return github.CreateRepo(delta)
+}
+
+func (delta DeltaRepoCreate) Provides() []string  { return []string{repoKey(delta.Repo.Name)} }
+func (delta DeltaRepoCreate) DependsOn() []string { return nil }
+
+// DeltaRepoUpdate sets all of a repo's settings and topics to the desired
+// values.
+type DeltaRepoUpdate struct {
+	Repo governance.GitHubRepo
+}
+
+func (delta DeltaRepoUpdate) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("updating repo",
+		zap.String("repo", delta.Repo.Name))
+
+	return github.UpdateRepo(delta)
+}
+
+func (delta DeltaRepoUpdate) Provides() []string  { return nil }
+func (delta DeltaRepoUpdate) DependsOn() []string { return []string{repoKey(delta.Repo.Name)} }
+
+type DeltaTeamCreate struct {
+	TeamName    string
+	Description string
+}
+
+func (delta DeltaTeamCreate) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("creating team",
+		zap.String("team", delta.TeamName))
+
+	return github.CreateTeam(delta)
+}
+
+func (delta DeltaTeamCreate) Provides() []string  { return []string{teamKey(delta.TeamName)} }
+func (delta DeltaTeamCreate) DependsOn() []string { return nil }
+
+type DeltaTeamUpdate struct {
+	TeamName    string
+	Description string
+}
+
+func (delta DeltaTeamUpdate) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("updating team",
+		zap.String("team", delta.TeamName),
+		zap.String("description", delta.Description))
+
+	return github.UpdateTeam(delta)
+}
+
+func (delta DeltaTeamUpdate) Provides() []string  { return nil }
+func (delta DeltaTeamUpdate) DependsOn() []string { return []string{teamKey(delta.TeamName)} }
+
+// DeltaMemberAdd invites a user to the organization, or changes their role if
+// they are already a member.
+type DeltaMemberAdd struct {
+	Login string
+	Role  governance.OrgRole
+}
+
+func (delta DeltaMemberAdd) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("adding member",
+		zap.String("user", delta.Login),
+		zap.String("role", string(delta.Role)))
+
+	return github.AddMember(delta)
+}
+
+func (delta DeltaMemberAdd) Provides() []string  { return []string{memberKey(delta.Login)} }
+func (delta DeltaMemberAdd) DependsOn() []string { return nil }
+
+// DeltaTeamMemberAdd adds a user to a team, or changes their role if they are
+// already a member.
+type DeltaTeamMemberAdd struct {
+	TeamName string
+	Login    string
+	Role     governance.TeamRole
+}
+
+func (delta DeltaTeamMemberAdd) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("adding team member",
+		zap.String("team", delta.TeamName),
+		zap.String("user", delta.Login),
+		zap.String("role", string(delta.Role)))
+
+	return github.AddTeamMember(delta)
+}
+
+func (delta DeltaTeamMemberAdd) Provides() []string { return nil }
+
+func (delta DeltaTeamMemberAdd) DependsOn() []string {
+	return []string{teamKey(delta.TeamName), memberKey(delta.Login)}
+}
+
+type DeltaTeamMemberRemove struct {
+	TeamName string
+	Login    string
+}
+
+func (delta DeltaTeamMemberRemove) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("removing team member",
+		zap.String("team", delta.TeamName),
+		zap.String("user", delta.Login))
+
+	return github.RemoveTeamMember(delta)
+}
+
+func (delta DeltaTeamMemberRemove) RemovalSubject() string {
+	return delta.Login
+}
+
+func (delta DeltaTeamMemberRemove) Provides() []string  { return nil }
+func (delta DeltaTeamMemberRemove) DependsOn() []string { return nil }
+
+// DeltaTeamRepoAdd grants a team access to a repo, or changes its permission
+// if it already has access.
+type DeltaTeamRepoAdd struct {
+	TeamName   string
+	Repo       string
+	Permission governance.RepoPermission
+}
+
+func (delta DeltaTeamRepoAdd) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("adding team repo",
+		zap.String("team", delta.TeamName),
+		zap.String("repo", delta.Repo),
+		zap.String("permission", string(delta.Permission)))
+
+	return github.AddTeamRepo(delta)
+}
+
+func (delta DeltaTeamRepoAdd) Provides() []string { return nil }
+
+func (delta DeltaTeamRepoAdd) DependsOn() []string {
+	return []string{teamKey(delta.TeamName), repoKey(delta.Repo)}
+}
+
+type DeltaTeamRepoRemove struct {
+	TeamName string
+	Repo     string
+}
+
+func (delta DeltaTeamRepoRemove) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("removing team repo",
+		zap.String("team", delta.TeamName),
+		zap.String("repo", delta.Repo))
+
+	return github.RemoveTeamRepo(delta)
+}
+
+// RemovalSubject is empty, as no member is removed.
+func (delta DeltaTeamRepoRemove) RemovalSubject() string {
+	return ""
+}
+
+func (delta DeltaTeamRepoRemove) Provides() []string  { return nil }
+func (delta DeltaTeamRepoRemove) DependsOn() []string { return nil }
+
+// DeltaCollaboratorAdd grants a user direct access to a repo, or changes
+// their permission if they already have access.
+type DeltaCollaboratorAdd struct {
+	Repo       string
+	Login      string
+	Permission governance.RepoPermission
+}
+
+func (delta DeltaCollaboratorAdd) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("adding collaborator",
+		zap.String("repo", delta.Repo),
+		zap.String("user", delta.Login),
+		zap.String("permission", string(delta.Permission)))
+
+	return github.AddCollaborator(delta)
+}
+
+func (delta DeltaCollaboratorAdd) Provides() []string  { return nil }
+func (delta DeltaCollaboratorAdd) DependsOn() []string { return []string{repoKey(delta.Repo)} }
+
+type DeltaCollaboratorRemove struct {
+	Repo  string
+	Login string
+}
+
+func (delta DeltaCollaboratorRemove) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("removing collaborator",
+		zap.String("repo", delta.Repo),
+		zap.String("user", delta.Login))
+
+	return github.RemoveCollaborator(delta)
+}
+
+func (delta DeltaCollaboratorRemove) RemovalSubject() string {
+	return delta.Login
+}
+
+func (delta DeltaCollaboratorRemove) Provides() []string  { return nil }
+func (delta DeltaCollaboratorRemove) DependsOn() []string { return nil }
+
+// DeltaBranchProtectionUpsert creates a branch protection rule, or updates the
+// existing rule with the same pattern.
+type DeltaBranchProtectionUpsert struct {
+	Repo string
+	Rule governance.GitHubRepoBranchProtectionRule
+}
+
+func (delta DeltaBranchProtectionUpsert) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("upserting branch protection",
+		zap.String("repo", delta.Repo),
+		zap.String("pattern", delta.Rule.Pattern))
+
+	return github.UpsertBranchProtection(delta)
+}
+
+func (delta DeltaBranchProtectionUpsert) Provides() []string  { return nil }
+func (delta DeltaBranchProtectionUpsert) DependsOn() []string { return []string{repoKey(delta.Repo)} }
+
+type DeltaBranchProtectionDelete struct {
+	Repo    string
+	Pattern string
+}
+
+func (delta DeltaBranchProtectionDelete) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("deleting branch protection",
+		zap.String("repo", delta.Repo),
+		zap.String("pattern", delta.Pattern))
+
+	return github.DeleteBranchProtection(delta)
+}
+
+// RemovalSubject is empty, as no member is removed.
+func (delta DeltaBranchProtectionDelete) RemovalSubject() string {
+	return ""
+}
+
+func (delta DeltaBranchProtectionDelete) Provides() []string  { return nil }
+func (delta DeltaBranchProtectionDelete) DependsOn() []string { return nil }
+
+type DeltaDeployKeyCreate struct {
+	Repo string
+	Key  governance.GitHubDeployKey
+}
+
+func (delta DeltaDeployKeyCreate) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("creating deploy key",
+		zap.String("repo", delta.Repo),
+		zap.String("title", delta.Key.Title),
+		zap.Bool("read-only", delta.Key.ReadOnly))
+
+	return github.CreateDeployKey(delta)
+}
+
+func (delta DeltaDeployKeyCreate) Provides() []string  { return nil }
+func (delta DeltaDeployKeyCreate) DependsOn() []string { return []string{repoKey(delta.Repo)} }
+
+type DeltaDeployKeyDelete struct {
+	Repo  string
+	Title string
+}
+
+func (delta DeltaDeployKeyDelete) Apply(logger *zap.Logger, github GitHub) error {
+	logger.Info("deleting deploy key",
+		zap.String("repo", delta.Repo),
+		zap.String("title", delta.Title))
+
+	return github.DeleteDeployKey(delta)
+}
+
+// RemovalSubject is empty, as no member is removed.
+func (delta DeltaDeployKeyDelete) RemovalSubject() string {
+	return ""
+}
+
+func (delta DeltaDeployKeyDelete) Provides() []string  { return nil }
+func (delta DeltaDeployKeyDelete) DependsOn() []string { return nil }
+
+// repoKey, teamKey, and memberKey identify what deltas provide and depend on,
+// as governance.Dependent.
+func repoKey(name string) string    { return "repo:" + name }
+func teamKey(name string) string    { return "team:" + name }
+func memberKey(login string) string { return "member:" + login }
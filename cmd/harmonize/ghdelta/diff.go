@@ -0,0 +1,262 @@
+package ghdelta
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/concourse/governance"
+)
+
+// Diff computes the deltas necessary to bring the organization in line with
+// the config. Teams and repos which are not in the config are left alone, as
+// are org members and owners: members are added and promoted, but never
+// removed or demoted.
+func Diff(config *governance.Config, github GitHub) ([]Delta, error) {
+	actual, err := github.State()
+	if err != nil {
+		return nil, fmt.Errorf("get state: %w", err)
+	}
+
+	return DiffState(config.DesiredGitHubState(), *actual), nil
+}
+
+// DiffState computes the deltas necessary to go from a previously loaded
+// state to the desired state.
+func DiffState(desired, actual governance.GitHubState) []Delta {
+	// copy so that placeholders for missing teams and repos don't leak into the
+	// caller's state
+	planned := actual
+	planned.Teams = append([]governance.GitHubTeam{}, actual.Teams...)
+	planned.Repos = append([]governance.GitHubRepo{}, actual.Repos...)
+
+	var deltas []Delta
+
+	for _, team := range desired.Teams {
+		if _, found := actual.Team(team.Name); found {
+			continue
+		}
+
+		deltas = append(deltas, DeltaTeamCreate{
+			TeamName:    team.Name,
+			Description: team.Description,
+		})
+
+		// diff against an empty team so that members and repos are added
+		planned.Teams = append(planned.Teams, governance.GitHubTeam{
+			Name:        team.Name,
+			Description: team.Description,
+		})
+	}
+
+	for _, repo := range desired.Repos {
+		if _, found := actual.Repo(repo.Name); found {
+			continue
+		}
+
+		deltas = append(deltas, DeltaRepoCreate{Repo: repo})
+
+		created := repo
+		created.DirectCollaborators = nil
+		created.BranchProtectionRules = nil
+		created.DeployKeys = nil
+		planned.Repos = append(planned.Repos, created)
+	}
+
+	updatedRepos := map[string]bool{}
+	upsertedRules := map[string]map[string]bool{}
+	replacedKeys := map[string]map[string]bool{}
+
+	for _, change := range governance.DiffGitHub(desired, planned) {
+		switch c := change.(type) {
+		case governance.GitHubMemberMissing:
+			deltas = append(deltas, DeltaMemberAdd{
+				Login: c.Login,
+				Role:  c.Role,
+			})
+
+		case governance.GitHubMemberRoleChanged:
+			// owners are only ever added; demoting one, like removing a member,
+			// is left to a human, since the config may simply not know about them
+			if c.Desired == governance.OrgRoleAdmin {
+				deltas = append(deltas, DeltaMemberAdd{
+					Login: c.Login,
+					Role:  c.Desired,
+				})
+			}
+
+		case governance.GitHubTeamFieldMismatch:
+			team, _ := desired.Team(c.Team)
+			deltas = append(deltas, DeltaTeamUpdate{
+				TeamName:    team.Name,
+				Description: team.Description,
+			})
+
+		case governance.GitHubTeamMemberMissing:
+			deltas = append(deltas, DeltaTeamMemberAdd{
+				TeamName: c.Team,
+				Login:    c.Login,
+				Role:     c.Role,
+			})
+
+		case governance.GitHubTeamMemberRoleChanged:
+			deltas = append(deltas, DeltaTeamMemberAdd{
+				TeamName: c.Team,
+				Login:    c.Login,
+				Role:     c.Desired,
+			})
+
+		case governance.GitHubTeamMemberUnexpected:
+			deltas = append(deltas, DeltaTeamMemberRemove{
+				TeamName: c.Team,
+				Login:    c.Login,
+			})
+
+		case governance.GitHubTeamRepoMissing:
+			deltas = append(deltas, DeltaTeamRepoAdd{
+				TeamName:   c.Team,
+				Repo:       c.Repo,
+				Permission: c.Permission,
+			})
+
+		case governance.GitHubTeamRepoPermissionChanged:
+			deltas = append(deltas, DeltaTeamRepoAdd{
+				TeamName:   c.Team,
+				Repo:       c.Repo,
+				Permission: c.Desired,
+			})
+
+		case governance.GitHubTeamRepoUnexpected:
+			deltas = append(deltas, DeltaTeamRepoRemove{
+				TeamName: c.Team,
+				Repo:     c.Repo,
+			})
+
+		case governance.GitHubRepoFieldMismatch:
+			if updatedRepos[c.Repo] {
+				continue
+			}
+
+			updatedRepos[c.Repo] = true
+
+			repo, _ := desired.Repo(c.Repo)
+			deltas = append(deltas, DeltaRepoUpdate{Repo: repo})
+
+		case governance.GitHubCollaboratorMissing:
+			deltas = append(deltas, DeltaCollaboratorAdd{
+				Repo:       c.Repo,
+				Login:      c.Login,
+				Permission: c.Permission,
+			})
+
+		case governance.GitHubCollaboratorPermissionChanged:
+			deltas = append(deltas, DeltaCollaboratorAdd{
+				Repo:       c.Repo,
+				Login:      c.Login,
+				Permission: c.Desired,
+			})
+
+		case governance.GitHubCollaboratorUnexpected:
+			deltas = append(deltas, DeltaCollaboratorRemove{
+				Repo:  c.Repo,
+				Login: c.Login,
+			})
+
+		case governance.GitHubBranchProtectionMissing:
+			deltas = append(deltas, upsertRule(desired, c.Repo, c.Pattern, upsertedRules)...)
+
+		case governance.GitHubBranchProtectionFieldMismatch:
+			deltas = append(deltas, upsertRule(desired, c.Repo, c.Pattern, upsertedRules)...)
+
+		case governance.GitHubBranchProtectionUnexpected:
+			deltas = append(deltas, DeltaBranchProtectionDelete{
+				Repo:    c.Repo,
+				Pattern: c.Pattern,
+			})
+
+		case governance.GitHubDeployKeyMissing:
+			repo, _ := desired.Repo(c.Repo)
+			key, _ := repo.DeployKey(c.Title)
+			deltas = append(deltas, DeltaDeployKeyCreate{
+				Repo: c.Repo,
+				Key:  key,
+			})
+
+		case governance.GitHubDeployKeyFieldMismatch:
+			// deploy keys can't be edited, so they have to be replaced
+			if replacedKeys[c.Repo] == nil {
+				replacedKeys[c.Repo] = map[string]bool{}
+			}
+
+			if replacedKeys[c.Repo][c.Title] {
+				continue
+			}
+
+			replacedKeys[c.Repo][c.Title] = true
+
+			repo, _ := desired.Repo(c.Repo)
+			key, _ := repo.DeployKey(c.Title)
+			deltas = append(deltas,
+				DeltaDeployKeyDelete{
+					Repo:  c.Repo,
+					Title: c.Title,
+				},
+				DeltaDeployKeyCreate{
+					Repo: c.Repo,
+					Key:  key,
+				},
+			)
+
+		case governance.GitHubDeployKeyUnexpected:
+			deltas = append(deltas, DeltaDeployKeyDelete{
+				Repo:  c.Repo,
+				Title: c.Title,
+			})
+		}
+	}
+
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return phase(deltas[i]) < phase(deltas[j])
+	})
+
+	return deltas
+}
+
+func upsertRule(desired governance.GitHubState, repoName, pattern string, upserted map[string]map[string]bool) []Delta {
+	if upserted[repoName] == nil {
+		upserted[repoName] = map[string]bool{}
+	}
+
+	if upserted[repoName][pattern] {
+		return nil
+	}
+
+	upserted[repoName][pattern] = true
+
+	repo, _ := desired.Repo(repoName)
+	rule, _ := repo.BranchProtectionRule(pattern)
+
+	return []Delta{
+		DeltaBranchProtectionUpsert{
+			Repo: repoName,
+			Rule: rule,
+		},
+	}
+}
+
+// phase orders deltas so that repos and teams exist before anything refers
+// to them, people are in the org before they're added to teams, and access is
+// granted before it's taken away.
+func phase(delta Delta) int {
+	switch delta.(type) {
+	case DeltaRepoCreate, DeltaRepoUpdate:
+		return 0
+	case DeltaTeamCreate, DeltaTeamUpdate:
+		return 1
+	case DeltaMemberAdd:
+		return 2
+	case DeltaTeamMemberRemove, DeltaTeamRepoRemove, DeltaCollaboratorRemove, DeltaBranchProtectionDelete:
+		return 4
+	default:
+		return 3
+	}
+}
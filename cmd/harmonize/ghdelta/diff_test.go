@@ -0,0 +1,211 @@
+package ghdelta_test
+
+import (
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/ghdelta"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// single config for all the tests to compare "reality" against
+var config = &governance.Config{
+	Contributors: map[string]governance.Person{
+		"andrew": {
+			Name:   "andrew",
+			GitHub: "andrew",
+			Owner:  true,
+		},
+		"potato": {
+			Name:   "potato",
+			GitHub: "potato",
+			Repos: map[string]string{
+				"fruit": "admin",
+			},
+		},
+	},
+	Teams: map[string]governance.Team{
+		"banana": {
+			Name:              "banana",
+			Purpose:           "Bananas.",
+			RawMembers:        []string{"andrew", "potato"},
+			RawMaintainers:    []string{"andrew"},
+			RawRepoPermission: "maintain",
+			Repos:             []string{"fruit"},
+		},
+	},
+	Repos: map[string]governance.Repo{
+		"fruit": {
+			Name:        "fruit",
+			Description: "Fruit.",
+			Topics:      []string{"food", "healthy"},
+			HasIssues:   true,
+			BranchProtection: []governance.RepoBranchProtection{
+				{
+					Pattern:         "master",
+					RequiredChecks:  []string{"ci"},
+					RequiredReviews: 1,
+				},
+			},
+			DeployKeys: []governance.RepoDeployKey{
+				{
+					Title:     "ci",
+					PublicKey: "ssh-ed25519 AAAA",
+				},
+			},
+		},
+	},
+}
+
+func syncedState() *governance.GitHubState {
+	state := config.DesiredGitHubState()
+	state.Organization = "concourse"
+	return &state
+}
+
+func TestSynced(t *testing.T) {
+	diff, err := ghdelta.Diff(config, fakeGitHub{state: syncedState()})
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func TestEmptyState(t *testing.T) {
+	github := fakeGitHub{
+		state: &governance.GitHubState{Organization: "concourse"},
+	}
+
+	desired := syncedState()
+	repo, _ := desired.Repo("fruit")
+
+	diff, err := ghdelta.Diff(config, github)
+	require.NoError(t, err)
+	require.Equal(t, ghdelta.DeltaRepoCreate{Repo: repo}, diff[0])
+	require.Equal(t, ghdelta.DeltaTeamCreate{TeamName: "banana", Description: "Bananas."}, diff[1])
+	require.ElementsMatch(t, []ghdelta.Delta{
+		ghdelta.DeltaMemberAdd{Login: "andrew", Role: governance.OrgRoleAdmin},
+		ghdelta.DeltaMemberAdd{Login: "potato", Role: governance.OrgRoleMember},
+	}, diff[2:4])
+	require.ElementsMatch(t, []ghdelta.Delta{
+		ghdelta.DeltaTeamMemberAdd{TeamName: "banana", Login: "andrew", Role: governance.TeamRoleMaintainer},
+		ghdelta.DeltaTeamMemberAdd{TeamName: "banana", Login: "potato", Role: governance.TeamRoleMember},
+		ghdelta.DeltaTeamRepoAdd{TeamName: "banana", Repo: "fruit", Permission: governance.RepoPermissionMaintain},
+		ghdelta.DeltaCollaboratorAdd{Repo: "fruit", Login: "potato", Permission: governance.RepoPermissionAdmin},
+		ghdelta.DeltaBranchProtectionUpsert{Repo: "fruit", Rule: repo.BranchProtectionRules[0]},
+		ghdelta.DeltaDeployKeyCreate{Repo: "fruit", Key: repo.DeployKeys[0]},
+	}, diff[4:])
+
+	core, observed := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	for i, delta := range diff {
+		err = delta.Apply(logger, github)
+		require.NoError(t, err)
+
+		require.Equal(t, i+1, observed.Len(), "%T did not log its activity", delta)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	desired := syncedState()
+	desiredRepo, _ := desired.Repo("fruit")
+
+	state := syncedState()
+
+	for i, member := range state.Members {
+		switch member.Login {
+		case "andrew":
+			state.Members[i].Role = governance.OrgRoleMember
+		case "potato":
+			// owners missing from the config are never demoted
+			state.Members[i].Role = governance.OrgRoleAdmin
+		}
+	}
+
+	// members missing from the config are never removed from the org
+	state.Members = append(state.Members, governance.GitHubOrgMember{
+		Login: "onion",
+		Role:  governance.OrgRoleMember,
+	})
+
+	state.Teams[0].Description = "Plantains."
+	state.Teams[0].Repos[0].Permission = governance.RepoPermissionWrite
+	state.Teams[0].Members = append(state.Teams[0].Members, governance.GitHubTeamMember{
+		Login: "onion",
+		Role:  governance.TeamRoleMember,
+	})
+
+	// not in config, so left alone
+	state.Teams = append(state.Teams, governance.GitHubTeam{Name: "hand-made"})
+	state.Repos = append(state.Repos, governance.GitHubRepo{Name: "hand-made"})
+
+	repo := &state.Repos[0]
+	repo.Topics = []string{"food"}
+	repo.HasWiki = true
+	repo.DirectCollaborators = append(repo.DirectCollaborators, governance.GitHubRepoCollaborator{
+		Login:      "onion",
+		Permission: governance.RepoPermissionWrite,
+	})
+	repo.BranchProtectionRules = []governance.GitHubRepoBranchProtectionRule{
+		{
+			Pattern:                     "master",
+			RequiredStatusCheckContexts: []string{},
+		},
+		{
+			Pattern:                     "release/*",
+			RequiredStatusCheckContexts: []string{},
+		},
+	}
+	repo.DeployKeys = []governance.GitHubDeployKey{
+		{
+			Title:    "ci",
+			Key:      "ssh-ed25519 BBBB",
+			ReadOnly: false,
+		},
+	}
+
+	diff, err := ghdelta.Diff(config, fakeGitHub{state: state})
+	require.NoError(t, err)
+	require.Equal(t, []ghdelta.Delta{
+		ghdelta.DeltaRepoUpdate{Repo: desiredRepo},
+		ghdelta.DeltaTeamUpdate{TeamName: "banana", Description: "Bananas."},
+		ghdelta.DeltaMemberAdd{Login: "andrew", Role: governance.OrgRoleAdmin},
+		ghdelta.DeltaTeamRepoAdd{TeamName: "banana", Repo: "fruit", Permission: governance.RepoPermissionMaintain},
+		ghdelta.DeltaBranchProtectionUpsert{Repo: "fruit", Rule: desiredRepo.BranchProtectionRules[0]},
+		ghdelta.DeltaDeployKeyDelete{Repo: "fruit", Title: "ci"},
+		ghdelta.DeltaDeployKeyCreate{Repo: "fruit", Key: desiredRepo.DeployKeys[0]},
+		ghdelta.DeltaTeamMemberRemove{TeamName: "banana", Login: "onion"},
+		ghdelta.DeltaCollaboratorRemove{Repo: "fruit", Login: "onion"},
+		ghdelta.DeltaBranchProtectionDelete{Repo: "fruit", Pattern: "release/*"},
+	}, diff)
+}
+
+type fakeGitHub struct {
+	state *governance.GitHubState
+}
+
+func (github fakeGitHub) State() (*governance.GitHubState, error) { return github.state, nil }
+
+func (github fakeGitHub) CreateRepo(ghdelta.DeltaRepoCreate) error                 { return nil }
+func (github fakeGitHub) UpdateRepo(ghdelta.DeltaRepoUpdate) error                 { return nil }
+func (github fakeGitHub) CreateTeam(ghdelta.DeltaTeamCreate) error                 { return nil }
+func (github fakeGitHub) UpdateTeam(ghdelta.DeltaTeamUpdate) error                 { return nil }
+func (github fakeGitHub) AddMember(ghdelta.DeltaMemberAdd) error                   { return nil }
+func (github fakeGitHub) AddTeamMember(ghdelta.DeltaTeamMemberAdd) error           { return nil }
+func (github fakeGitHub) RemoveTeamMember(ghdelta.DeltaTeamMemberRemove) error     { return nil }
+func (github fakeGitHub) AddTeamRepo(ghdelta.DeltaTeamRepoAdd) error               { return nil }
+func (github fakeGitHub) RemoveTeamRepo(ghdelta.DeltaTeamRepoRemove) error         { return nil }
+func (github fakeGitHub) AddCollaborator(ghdelta.DeltaCollaboratorAdd) error       { return nil }
+func (github fakeGitHub) RemoveCollaborator(ghdelta.DeltaCollaboratorRemove) error { return nil }
+func (github fakeGitHub) CreateDeployKey(ghdelta.DeltaDeployKeyCreate) error       { return nil }
+func (github fakeGitHub) DeleteDeployKey(ghdelta.DeltaDeployKeyDelete) error       { return nil }
+
+func (github fakeGitHub) UpsertBranchProtection(ghdelta.DeltaBranchProtectionUpsert) error {
+	return nil
+}
+
+func (github fakeGitHub) DeleteBranchProtection(ghdelta.DeltaBranchProtectionDelete) error {
+	return nil
+}
@@ -0,0 +1,476 @@
+package ghdelta
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/concourse/governance"
+	gh "github.com/google/go-github/v35/github"
+	"github.com/shurcooL/githubv4"
+	"golang.org/x/oauth2"
+)
+
+type GitHub interface {
+	State() (*governance.GitHubState, error)
+
+	CreateRepo(DeltaRepoCreate) error
+	UpdateRepo(DeltaRepoUpdate) error
+
+	CreateTeam(DeltaTeamCreate) error
+	UpdateTeam(DeltaTeamUpdate) error
+
+	AddMember(DeltaMemberAdd) error
+
+	AddTeamMember(DeltaTeamMemberAdd) error
+	RemoveTeamMember(DeltaTeamMemberRemove) error
+
+	AddTeamRepo(DeltaTeamRepoAdd) error
+	RemoveTeamRepo(DeltaTeamRepoRemove) error
+
+	AddCollaborator(DeltaCollaboratorAdd) error
+	RemoveCollaborator(DeltaCollaboratorRemove) error
+
+	UpsertBranchProtection(DeltaBranchProtectionUpsert) error
+	DeleteBranchProtection(DeltaBranchProtectionDelete) error
+
+	CreateDeployKey(DeltaDeployKeyCreate) error
+	DeleteDeployKey(DeltaDeployKeyDelete) error
+}
+
+type github struct {
+	ctx context.Context
+	org string
+
+	v3 *gh.Client
+	v4 *githubv4.Client
+
+	// team slugs by name, populated lazily
+	slugs map[string]string
+}
+
+func NewGitHub(ctx context.Context, org, token string) (GitHub, error) {
+	if token == "" {
+		return nil, fmt.Errorf("github: %w", governance.ErrMissingCredentials)
+	}
+
+	httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	))
+
+	return &github{
+		ctx: ctx,
+		org: org,
+
+		v3: gh.NewClient(httpClient),
+		v4: githubv4.NewClient(httpClient),
+	}, nil
+}
+
+func (github *github) State() (*governance.GitHubState, error) {
+	return governance.LoadGitHubStateWithClient(github.ctx, github.v4, github.org)
+}
+
+func (github *github) CreateRepo(delta DeltaRepoCreate) error {
+	_, _, err := github.v3.Repositories.Create(github.ctx, github.org, repository(delta.Repo))
+	if err != nil {
+		return fmt.Errorf("create repo: %w", err)
+	}
+
+	return github.replaceTopics(delta.Repo)
+}
+
+func (github *github) UpdateRepo(delta DeltaRepoUpdate) error {
+	_, _, err := github.v3.Repositories.Edit(github.ctx, github.org, delta.Repo.Name, repository(delta.Repo))
+	if err != nil {
+		return fmt.Errorf("edit repo: %w", err)
+	}
+
+	return github.replaceTopics(delta.Repo)
+}
+
+func (github *github) replaceTopics(repo governance.GitHubRepo) error {
+	topics := repo.Topics
+	if topics == nil {
+		// a nil slice is omitted from the request, rather than clearing topics
+		topics = []string{}
+	}
+
+	_, _, err := github.v3.Repositories.ReplaceAllTopics(github.ctx, github.org, repo.Name, topics)
+	if err != nil {
+		return fmt.Errorf("replace topics: %w", err)
+	}
+
+	return nil
+}
+
+// repository converts the repo's settings to a request body, along with the
+// hardcoded defaults from github.tf.
+func repository(repo governance.GitHubRepo) *gh.Repository {
+	return &gh.Repository{
+		Name:        gh.String(repo.Name),
+		Description: gh.String(repo.Description),
+		Homepage:    gh.String(repo.HomepageURL),
+		Private:     gh.Bool(repo.IsPrivate),
+		HasIssues:   gh.Bool(repo.HasIssues),
+		HasProjects: gh.Bool(repo.HasProjects),
+		HasWiki:     gh.Bool(repo.HasWiki),
+
+		HasDownloads:        gh.Bool(false),
+		DeleteBranchOnMerge: gh.Bool(true),
+	}
+}
+
+func (github *github) CreateTeam(delta DeltaTeamCreate) error {
+	team, _, err := github.v3.Teams.CreateTeam(github.ctx, github.org, gh.NewTeam{
+		Name:        delta.TeamName,
+		Description: gh.String(delta.Description),
+		Privacy:     gh.String("closed"),
+	})
+	if err != nil {
+		return fmt.Errorf("create team: %w", err)
+	}
+
+	if github.slugs != nil {
+		github.slugs[delta.TeamName] = team.GetSlug()
+	}
+
+	return nil
+}
+
+func (github *github) UpdateTeam(delta DeltaTeamUpdate) error {
+	slug, err := github.teamSlug(delta.TeamName)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = github.v3.Teams.EditTeamBySlug(github.ctx, github.org, slug, gh.NewTeam{
+		Name:        delta.TeamName,
+		Description: gh.String(delta.Description),
+		Privacy:     gh.String("closed"),
+	}, false)
+	if err != nil {
+		return fmt.Errorf("edit team: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) AddMember(delta DeltaMemberAdd) error {
+	_, _, err := github.v3.Organizations.EditOrgMembership(github.ctx, delta.Login, github.org, &gh.Membership{
+		Role: gh.String(strings.ToLower(string(delta.Role))),
+	})
+	if err != nil {
+		return fmt.Errorf("edit membership: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) AddTeamMember(delta DeltaTeamMemberAdd) error {
+	slug, err := github.teamSlug(delta.TeamName)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = github.v3.Teams.AddTeamMembershipBySlug(github.ctx, github.org, slug, delta.Login, &gh.TeamAddTeamMembershipOptions{
+		Role: strings.ToLower(string(delta.Role)),
+	})
+	if err != nil {
+		return fmt.Errorf("add team membership: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) RemoveTeamMember(delta DeltaTeamMemberRemove) error {
+	slug, err := github.teamSlug(delta.TeamName)
+	if err != nil {
+		return err
+	}
+
+	_, err = github.v3.Teams.RemoveTeamMembershipBySlug(github.ctx, github.org, slug, delta.Login)
+	if err != nil {
+		return fmt.Errorf("remove team membership: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) AddTeamRepo(delta DeltaTeamRepoAdd) error {
+	slug, err := github.teamSlug(delta.TeamName)
+	if err != nil {
+		return err
+	}
+
+	_, err = github.v3.Teams.AddTeamRepoBySlug(github.ctx, github.org, slug, github.org, delta.Repo, &gh.TeamAddTeamRepoOptions{
+		Permission: governance.Permission4to3(delta.Permission),
+	})
+	if err != nil {
+		return fmt.Errorf("add team repo: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) RemoveTeamRepo(delta DeltaTeamRepoRemove) error {
+	slug, err := github.teamSlug(delta.TeamName)
+	if err != nil {
+		return err
+	}
+
+	_, err = github.v3.Teams.RemoveTeamRepoBySlug(github.ctx, github.org, slug, github.org, delta.Repo)
+	if err != nil {
+		return fmt.Errorf("remove team repo: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) AddCollaborator(delta DeltaCollaboratorAdd) error {
+	_, _, err := github.v3.Repositories.AddCollaborator(github.ctx, github.org, delta.Repo, delta.Login, &gh.RepositoryAddCollaboratorOptions{
+		Permission: governance.Permission4to3(delta.Permission),
+	})
+	if err != nil {
+		return fmt.Errorf("add collaborator: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) RemoveCollaborator(delta DeltaCollaboratorRemove) error {
+	_, err := github.v3.Repositories.RemoveCollaborator(github.ctx, github.org, delta.Repo, delta.Login)
+	if err != nil {
+		return fmt.Errorf("remove collaborator: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) UpsertBranchProtection(delta DeltaBranchProtectionUpsert) error {
+	repoID, ruleID, err := github.branchProtectionRuleID(delta.Repo, delta.Rule.Pattern)
+	if err != nil {
+		return err
+	}
+
+	rule := delta.Rule
+	contexts := make([]githubv4.String, len(rule.RequiredStatusCheckContexts))
+	for i, c := range rule.RequiredStatusCheckContexts {
+		contexts[i] = githubv4.String(c)
+	}
+
+	reviewCount := githubv4.Int(rule.RequiredApprovingReviewCount)
+
+	if ruleID == nil {
+		var m struct {
+			CreateBranchProtectionRule struct {
+				ClientMutationID string
+			} `graphql:"createBranchProtectionRule(input: $input)"`
+		}
+
+		err = github.v4.Mutate(github.ctx, &m, githubv4.CreateBranchProtectionRuleInput{
+			RepositoryID: repoID,
+			Pattern:      githubv4.String(rule.Pattern),
+
+			IsAdminEnforced:              githubv4.NewBoolean(githubv4.Boolean(rule.IsAdminEnforced)),
+			AllowsDeletions:              githubv4.NewBoolean(githubv4.Boolean(rule.AllowsDeletions)),
+			AllowsForcePushes:            githubv4.NewBoolean(githubv4.Boolean(rule.AllowsForcePushes)),
+			RequiresLinearHistory:        githubv4.NewBoolean(githubv4.Boolean(rule.RequiresLinearHistory)),
+			RequiresStatusChecks:         githubv4.NewBoolean(githubv4.Boolean(rule.RequiresStatusChecks)),
+			RequiresStrictStatusChecks:   githubv4.NewBoolean(githubv4.Boolean(rule.RequiresStrictStatusChecks)),
+			RequiredStatusCheckContexts:  &contexts,
+			RestrictsPushes:              githubv4.NewBoolean(githubv4.Boolean(rule.RestrictsPushes)),
+			RequiresCommitSignatures:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresCommitSignatures)),
+			RequiresApprovingReviews:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresApprovingReviews)),
+			RequiredApprovingReviewCount: &reviewCount,
+			DismissesStaleReviews:        githubv4.NewBoolean(githubv4.Boolean(rule.DismissesStaleReviews)),
+			RequiresCodeOwnerReviews:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresCodeOwnerReviews)),
+			RestrictsReviewDismissals:    githubv4.NewBoolean(githubv4.Boolean(rule.RestrictsReviewDismissals)),
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("create branch protection rule: %w", err)
+		}
+
+		return nil
+	}
+
+	var m struct {
+		UpdateBranchProtectionRule struct {
+			ClientMutationID string
+		} `graphql:"updateBranchProtectionRule(input: $input)"`
+	}
+
+	err = github.v4.Mutate(github.ctx, &m, githubv4.UpdateBranchProtectionRuleInput{
+		BranchProtectionRuleID: ruleID,
+		Pattern:                githubv4.NewString(githubv4.String(rule.Pattern)),
+
+		IsAdminEnforced:              githubv4.NewBoolean(githubv4.Boolean(rule.IsAdminEnforced)),
+		AllowsDeletions:              githubv4.NewBoolean(githubv4.Boolean(rule.AllowsDeletions)),
+		AllowsForcePushes:            githubv4.NewBoolean(githubv4.Boolean(rule.AllowsForcePushes)),
+		RequiresLinearHistory:        githubv4.NewBoolean(githubv4.Boolean(rule.RequiresLinearHistory)),
+		RequiresStatusChecks:         githubv4.NewBoolean(githubv4.Boolean(rule.RequiresStatusChecks)),
+		RequiresStrictStatusChecks:   githubv4.NewBoolean(githubv4.Boolean(rule.RequiresStrictStatusChecks)),
+		RequiredStatusCheckContexts:  &contexts,
+		RestrictsPushes:              githubv4.NewBoolean(githubv4.Boolean(rule.RestrictsPushes)),
+		RequiresCommitSignatures:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresCommitSignatures)),
+		RequiresApprovingReviews:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresApprovingReviews)),
+		RequiredApprovingReviewCount: &reviewCount,
+		DismissesStaleReviews:        githubv4.NewBoolean(githubv4.Boolean(rule.DismissesStaleReviews)),
+		RequiresCodeOwnerReviews:     githubv4.NewBoolean(githubv4.Boolean(rule.RequiresCodeOwnerReviews)),
+		RestrictsReviewDismissals:    githubv4.NewBoolean(githubv4.Boolean(rule.RestrictsReviewDismissals)),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("update branch protection rule: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) DeleteBranchProtection(delta DeltaBranchProtectionDelete) error {
+	_, ruleID, err := github.branchProtectionRuleID(delta.Repo, delta.Pattern)
+	if err != nil {
+		return err
+	}
+
+	if ruleID == nil {
+		// already gone
+		return nil
+	}
+
+	var m struct {
+		DeleteBranchProtectionRule struct {
+			ClientMutationID string
+		} `graphql:"deleteBranchProtectionRule(input: $input)"`
+	}
+
+	err = github.v4.Mutate(github.ctx, &m, githubv4.DeleteBranchProtectionRuleInput{
+		BranchProtectionRuleID: ruleID,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("delete branch protection rule: %w", err)
+	}
+
+	return nil
+}
+
+// branchProtectionRuleID returns the node ID of the repo and of the rule
+// with the given pattern, if it exists. The loaded state doesn't carry node
+// IDs, so they're fetched as needed.
+func (github *github) branchProtectionRuleID(repo, pattern string) (githubv4.ID, githubv4.ID, error) {
+	args := map[string]interface{}{
+		"org":   githubv4.String(github.org),
+		"name":  githubv4.String(repo),
+		"after": (*githubv4.String)(nil),
+	}
+
+	for {
+		var q struct {
+			Repository struct {
+				ID                    githubv4.ID
+				BranchProtectionRules struct {
+					Nodes []struct {
+						ID      githubv4.ID
+						Pattern string
+					}
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"branchProtectionRules(first: 100, after: $after)"`
+			} `graphql:"repository(owner: $org, name: $name)"`
+		}
+
+		err := github.v4.Query(github.ctx, &q, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get branch protection rules: %w", err)
+		}
+
+		for _, node := range q.Repository.BranchProtectionRules.Nodes {
+			if node.Pattern == pattern {
+				return q.Repository.ID, node.ID, nil
+			}
+		}
+
+		if !q.Repository.BranchProtectionRules.PageInfo.HasNextPage {
+			return q.Repository.ID, nil, nil
+		}
+
+		args["after"] = githubv4.NewString(q.Repository.BranchProtectionRules.PageInfo.EndCursor)
+	}
+}
+
+func (github *github) CreateDeployKey(delta DeltaDeployKeyCreate) error {
+	_, _, err := github.v3.Repositories.CreateKey(github.ctx, github.org, delta.Repo, &gh.Key{
+		Title:    gh.String(delta.Key.Title),
+		Key:      gh.String(delta.Key.Key),
+		ReadOnly: gh.Bool(delta.Key.ReadOnly),
+	})
+	if err != nil {
+		return fmt.Errorf("create deploy key: %w", err)
+	}
+
+	return nil
+}
+
+func (github *github) DeleteDeployKey(delta DeltaDeployKeyDelete) error {
+	opts := &gh.ListOptions{PerPage: 100}
+	for {
+		keys, res, err := github.v3.Repositories.ListKeys(github.ctx, github.org, delta.Repo, opts)
+		if err != nil {
+			return fmt.Errorf("list deploy keys: %w", err)
+		}
+
+		for _, key := range keys {
+			if key.GetTitle() != delta.Title {
+				continue
+			}
+
+			_, err := github.v3.Repositories.DeleteKey(github.ctx, github.org, delta.Repo, key.GetID())
+			if err != nil {
+				return fmt.Errorf("delete deploy key: %w", err)
+			}
+
+			return nil
+		}
+
+		if res.NextPage == 0 {
+			// already gone
+			return nil
+		}
+
+		opts.Page = res.NextPage
+	}
+}
+
+func (github *github) teamSlug(name string) (string, error) {
+	if github.slugs == nil {
+		slugs := map[string]string{}
+
+		opts := &gh.ListOptions{PerPage: 100}
+		for {
+			teams, res, err := github.v3.Teams.ListTeams(github.ctx, github.org, opts)
+			if err != nil {
+				return "", fmt.Errorf("list teams: %w", err)
+			}
+
+			for _, team := range teams {
+				slugs[team.GetName()] = team.GetSlug()
+			}
+
+			if res.NextPage == 0 {
+				break
+			}
+
+			opts.Page = res.NextPage
+		}
+
+		github.slugs = slugs
+	}
+
+	slug, found := github.slugs[name]
+	if !found {
+		return "", fmt.Errorf("team %q not found", name)
+	}
+
+	return slug, nil
+}
@@ -0,0 +1,79 @@
+package ghdelta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/concourse/governance"
+	gh "github.com/google/go-github/v35/github"
+	"go.uber.org/zap"
+)
+
+// Provider synchronizes a GitHub organization as a governance.Provider.
+type Provider struct {
+	GitHub GitHub
+}
+
+func (provider Provider) Name() string {
+	return "github"
+}
+
+func (provider Provider) Load(context.Context) (governance.ProviderState, error) {
+	state, err := provider.GitHub.State()
+	if err != nil {
+		return nil, err
+	}
+
+	return *state, nil
+}
+
+func (provider Provider) Desired(config *governance.Config) (governance.ProviderState, error) {
+	return config.DesiredGitHubState(), nil
+}
+
+func (provider Provider) Diff(desired, actual governance.ProviderState) ([]governance.ProviderDelta, error) {
+	desiredState, ok := desired.(governance.GitHubState)
+	if !ok {
+		return nil, fmt.Errorf("unexpected desired state: %T", desired)
+	}
+
+	actualState, ok := actual.(governance.GitHubState)
+	if !ok {
+		return nil, fmt.Errorf("unexpected actual state: %T", actual)
+	}
+
+	deltas := DiffState(desiredState, actualState)
+
+	providerDeltas := make([]governance.ProviderDelta, len(deltas))
+	for i, delta := range deltas {
+		providerDeltas[i] = delta
+	}
+
+	return providerDeltas, nil
+}
+
+func (provider Provider) Apply(_ context.Context, logger *zap.Logger, providerDelta governance.ProviderDelta) error {
+	delta, ok := providerDelta.(Delta)
+	if !ok {
+		return fmt.Errorf("unexpected delta: %T", providerDelta)
+	}
+
+	return classify(delta.Apply(logger, provider.GitHub))
+}
+
+// classify marks rate limits and server errors as retryable.
+func classify(err error) error {
+	var rateLimitErr *gh.RateLimitError
+	var abuseErr *gh.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return governance.Retryable(err)
+	}
+
+	var resErr *gh.ErrorResponse
+	if errors.As(err, &resErr) && resErr.Response != nil && resErr.Response.StatusCode >= 500 {
+		return governance.Retryable(err)
+	}
+
+	return err
+}
@@ -1,17 +1,66 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/concourse/governance"
 	"github.com/concourse/governance/cmd/harmonize/delta"
+	"github.com/concourse/governance/cmd/harmonize/ghdelta"
+	"github.com/concourse/governance/cmd/harmonize/mgdelta"
 	"go.uber.org/zap"
 )
 
 // Concourse Discord server ID
 const guildID = "219899946617274369"
 
+// Concourse GitHub organization
+const organization = "concourse"
+
+// Concourse Mailgun domain
+const domain = "concourse-ci.org"
+
+// rate limits and server errors are retried this many times, waiting
+// backoff before the first retry and twice as long for each one after
+const (
+	retries = 4
+	backoff = time.Second
+)
+
+const usage = `usage:
+  harmonize [flags]                  synchronize everything
+  harmonize [flags] plan [-out FILE] write the Discord deltas to a plan file
+  harmonize [flags] apply FILE       apply a plan file to Discord
+  harmonize [flags] watch [-interval DURATION]
+                                     sync Discord members as they join or change
+  harmonize [flags] rollback [-out FILE] RUN-ID
+                                     write a plan undoing a run's Discord changes
+
+flags:`
+
+// options are the flags shared by every mode.
+type options struct {
+	guard       governance.BlastRadius
+	nicknames   bool
+	concurrency int
+
+	// providers are the services to synchronize, by name.
+	providers map[string]bool
+
+	// journal records changes to Discord, if enabled.
+	journal *delta.Journal
+}
+
 func main() {
 	logger, err := zap.NewDevelopment(zap.IncreaseLevel(zap.InfoLevel))
 	if err != nil {
@@ -20,43 +69,446 @@ func main() {
 
 	defer logger.Sync()
 
-	token := os.Getenv("DISCORD_TOKEN")
-	if token == "" {
-		logger.Fatal("no $DISCORD_TOKEN provided")
+	// stop watching, retrying, or applying more deltas on Ctrl-C or when the
+	// job is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	maxRemovals := flag.Int("max-removals", 20, "refuse to apply more than this many removals per service")
+	maxPercent := flag.Float64("max-removal-percent", 10, "refuse to apply removals affecting more than this percentage of members")
+	allowMassRemoval := flag.Bool("allow-mass-removal", false, "apply even if the removal limits are exceeded")
+	nicknames := flag.Bool("nicknames", false, "set linked contributors' Discord nicknames to their names")
+	concurrency := flag.Int("concurrency", 4, "how many members to update at once")
+	providers := flag.String("providers", "discord", "comma-separated services to synchronize: discord, github, mailgun")
+	journalPath := flag.String("journal", "journal.jsonl", "file to record Discord changes to, or empty to disable")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flag.PrintDefaults()
 	}
 
-	discord, err := delta.NewDiscord(guildID, token)
+	flag.Parse()
+
+	guard := governance.BlastRadius{
+		MaxRemovals: *maxRemovals,
+		MaxPercent:  *maxPercent,
+	}
+
+	if *allowMassRemoval {
+		logger.Warn("removal limits disabled")
+		guard = governance.BlastRadius{}
+	}
+
+	opts := options{
+		guard:       guard,
+		nicknames:   *nicknames,
+		concurrency: *concurrency,
+		providers:   map[string]bool{},
+	}
+
+	for _, name := range strings.Split(*providers, ",") {
+		name = strings.TrimSpace(name)
+
+		switch name {
+		case "discord", "github", "mailgun":
+			opts.providers[name] = true
+		default:
+			logger.Fatal("unknown provider", zap.String("provider", name))
+		}
+	}
+
+	args := flag.Args()
+
+	// dry runs change nothing, so there's nothing to journal
+	journaling := (len(args) == 0 || args[0] == "apply" || args[0] == "watch") &&
+		os.Getenv("DISCORD_DRY_RUN") == ""
+
+	// the default path is lost along with the CI runner, so the workflow has
+	// to choose where to write the journal and upload it from
+	if journaling && os.Getenv("CI") != "" && (!flagSet("journal") || *journalPath == "") {
+		logger.Fatal("-journal must be given explicitly in CI, and the journal uploaded once the run is done")
+	}
+
+	if *journalPath != "" && journaling {
+		file, err := os.OpenFile(*journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logger.Fatal("failed to open journal", zap.Error(err))
+		}
+
+		defer file.Close()
+
+		opts.journal = delta.NewJournal(file)
+	}
+
+	if len(args) == 0 {
+		harmonize(ctx, logger, opts)
+		return
+	}
+
+	switch args[0] {
+	case "plan":
+		flags := flag.NewFlagSet("plan", flag.ExitOnError)
+		out := flags.String("out", "plan.json", "file to write the plan to")
+		_ = flags.Parse(args[1:])
+
+		plan(logger, *out, opts)
+
+	case "apply":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		apply(ctx, logger, args[1], opts)
+
+	case "watch":
+		flags := flag.NewFlagSet("watch", flag.ExitOnError)
+		interval := flags.Duration("interval", time.Hour, "how often to synchronize everything")
+		_ = flags.Parse(args[1:])
+
+		watch(ctx, logger, opts, *interval)
+
+	case "rollback":
+		flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+		out := flags.String("out", "rollback.json", "file to write the plan to")
+		_ = flags.Parse(args[1:])
+
+		if flags.NArg() != 1 || *journalPath == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		rollback(logger, *journalPath, flags.Arg(0), *out)
+
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+func harmonize(ctx context.Context, logger *zap.Logger, opts options) {
+	var discord delta.Discord
+	if opts.providers["discord"] {
+		discord = journaled(logger, newDiscord(logger), opts.journal)
+	}
+
+	runner := newRunner(ctx, logger, discord, opts)
+
+	err := runner.Run(ctx, loadConfig(logger))
 	if err != nil {
-		logger.Fatal("failed to initialize discord", zap.Error(err))
+		refuse(logger, err)
+		report(logger, err)
+		logger.Fatal("failed to harmonize", zap.Error(err))
 	}
+}
 
-	if os.Getenv("DISCORD_DRY_RUN") != "" {
-		logger.Info("performing dry run")
+// newRunner configures each of the services given by -providers.
+func newRunner(ctx context.Context, logger *zap.Logger, discord delta.Discord, opts options) governance.Runner {
+	var providers []governance.Provider
 
-		discord = dryRunDiscord{discord}
+	if opts.providers["discord"] {
+		providers = append(providers, delta.Provider{
+			Discord:   discord,
+			Logger:    logger.Named("discord"),
+			Nicknames: opts.nicknames,
+		})
 	}
 
-	config, err := governance.LoadConfig(os.DirFS("."))
+	// GitHub and Mailgun are still managed by Terraform, so they're only
+	// synchronized when explicitly asked for
+	if opts.providers["github"] {
+		githubToken := os.Getenv("GITHUB_TOKEN")
+		if githubToken == "" {
+			logger.Fatal("no $GITHUB_TOKEN provided")
+		}
+
+		github, err := ghdelta.NewGitHub(ctx, organization, githubToken)
+		if err != nil {
+			logger.Fatal("failed to initialize github", zap.Error(err))
+		}
+
+		if os.Getenv("GITHUB_DRY_RUN") != "" {
+			logger.Info("performing github dry run")
+
+			github = dryRunGitHub{github}
+		}
+
+		providers = append(providers, ghdelta.Provider{GitHub: github})
+	}
+
+	if opts.providers["mailgun"] {
+		mailgunAPIKey := os.Getenv("MAILGUN_API_KEY")
+		if mailgunAPIKey == "" {
+			logger.Fatal("no $MAILGUN_API_KEY provided")
+		}
+
+		mailgun, err := mgdelta.NewMailgun(ctx, domain, governance.MailgunOptions{
+			APIKey: mailgunAPIKey,
+		})
+		if err != nil {
+			logger.Fatal("failed to initialize mailgun", zap.Error(err))
+		}
+
+		if os.Getenv("MAILGUN_DRY_RUN") != "" {
+			logger.Info("performing mailgun dry run")
+
+			mailgun = dryRunMailgun{mailgun}
+		}
+
+		providers = append(providers, mgdelta.Provider{
+			Domain:  domain,
+			Mailgun: mailgun,
+		})
+	}
+
+	runner := newApplier(logger, opts)
+	runner.Providers = providers
+
+	return runner
+}
+
+// newApplier configures a runner for applying plans made elsewhere, without
+// any providers of its own.
+func newApplier(logger *zap.Logger, opts options) governance.Runner {
+	return governance.Runner{
+		BlastRadius: opts.guard,
+		Logger:      logger,
+		Concurrency: opts.concurrency,
+		Retries:     retries,
+		Backoff:     backoff,
+	}
+}
+
+func plan(logger *zap.Logger, out string, opts options) {
+	discord := newDiscord(logger)
+
+	config := loadConfig(logger)
+
+	state, err := delta.LoadState(discord)
 	if err != nil {
-		logger.Fatal("failed to load config", zap.Error(err))
+		logger.Fatal("failed to load discord state", zap.Error(err))
 	}
 
-	diff, err := delta.Diff(config, discord)
+	delta.WarnUnresolved(logger, config, state)
+
+	diff, err := delta.DiffState(config, state)
 	if err != nil {
 		logger.Fatal("failed to compute diff", zap.Error(err))
 	}
 
-	if len(diff) == 0 {
-		logger.Info("nothing to do")
+	if opts.nicknames {
+		nicknameDeltas, unrenamable := delta.DiffNicknames(config, state)
+		diff = append(diff, nicknameDeltas...)
+
+		delta.WarnUnrenamable(logger, unrenamable)
+	}
+
+	err = opts.guard.Check(discordPlan(discord, state, diff))
+	if err != nil {
+		// still write the plan so it can be reviewed
+		refuse(logger, err)
+		logger.Warn("plan will be refused without -allow-mass-removal", zap.Error(err))
+	}
+
+	writePlan(logger, out, newPlan(logger, config, state, diff))
+}
+
+func newPlan(logger *zap.Logger, config *governance.Config, state delta.State, deltas []delta.Delta) delta.Plan {
+	plan, err := delta.NewPlan(guildID, config, state, deltas)
+	if err != nil {
+		logger.Fatal("failed to snapshot discord state", zap.Error(err))
+	}
+
+	return plan
+}
+
+func writePlan(logger *zap.Logger, out string, plan delta.Plan) {
+	payload, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		logger.Fatal("failed to marshal plan", zap.Error(err))
+	}
+
+	err = ioutil.WriteFile(out, append(payload, '\n'), 0644)
+	if err != nil {
+		logger.Fatal("failed to write plan", zap.Error(err))
+	}
+
+	logger.Info("wrote plan",
+		zap.String("path", out),
+		zap.Int("deltas", len(plan.Deltas)))
+}
+
+func apply(ctx context.Context, logger *zap.Logger, path string, opts options) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Fatal("failed to read plan", zap.Error(err))
+	}
+
+	var plan delta.Plan
+	err = json.Unmarshal(payload, &plan)
+	if err != nil {
+		logger.Fatal("failed to parse plan", zap.Error(err))
+	}
+
+	discord := newDiscord(logger)
+
+	config := loadConfig(logger)
+
+	state, err := delta.LoadState(discord)
+	if err != nil {
+		logger.Fatal("failed to load discord state", zap.Error(err))
+	}
+
+	err = plan.Verify(guildID, config, state)
+	if err != nil {
+		logger.Fatal("refusing to apply plan; run plan again", zap.Error(err))
+	}
+
+	runner := newApplier(logger, opts)
+
+	discord = journaled(logger, discord, opts.journal)
+
+	err = runner.Apply(ctx, []governance.ProviderPlan{discordPlan(discord, state, plan.Deltas)})
+	if err != nil {
+		refuse(logger, err)
+		report(logger, err)
+		logger.Fatal("failed to apply plan", zap.Error(err))
+	}
+}
+
+func discordPlan(discord delta.Discord, state delta.State, deltas []delta.Delta) governance.ProviderPlan {
+	plan := governance.ProviderPlan{
+		Provider:   delta.Provider{Discord: discord},
+		Population: state.Population(),
+	}
+
+	for _, d := range deltas {
+		plan.Deltas = append(plan.Deltas, d)
+	}
+
+	return plan
+}
+
+// refuse prints the offending deltas if err is from the BlastRadius guard.
+func refuse(logger *zap.Logger, err error) {
+	var blastErr governance.BlastRadiusError
+	if !errors.As(err, &blastErr) {
 		return
 	}
 
-	for _, delta := range diff {
-		err := delta.Apply(logger, discord)
-		if err != nil {
-			logger.Sugar().Fatalf("failed to apply %T: %s", delta, err)
+	logger.Error("removals exceed the limits; re-run with -allow-mass-removal if they are intended")
+
+	fmt.Fprintln(os.Stderr, blastErr.Deltas())
+}
+
+// report logs every delta that failed if err is from applying them.
+func report(logger *zap.Logger, err error) {
+	var applyErr governance.ApplyError
+	if !errors.As(err, &applyErr) {
+		return
+	}
+
+	for _, failure := range applyErr.Failures {
+		logger.Error("failed to apply delta",
+			zap.String("provider", failure.Provider),
+			zap.String("delta", fmt.Sprintf("%T %+v", failure.Delta, failure.Delta)),
+			zap.Bool("retryable", governance.IsRetryable(failure.Err)),
+			zap.Error(failure.Err))
+	}
+}
+
+// rollback writes a plan undoing the changes a run made to Discord, for review
+// and then apply.
+func rollback(logger *zap.Logger, journalPath, runID, out string) {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		logger.Fatal("failed to open journal", zap.Error(err))
+	}
+
+	defer file.Close()
+
+	entries, err := delta.ReadJournal(file, runID)
+	if err != nil {
+		logger.Fatal("failed to read journal", zap.Error(err))
+	}
+
+	if len(entries) == 0 {
+		logger.Fatal("no changes recorded for run", zap.String("run-id", runID))
+	}
+
+	deltas, irreversible := delta.Rollback(entries)
+	for _, entry := range irreversible {
+		logger.Warn("change cannot be rolled back",
+			zap.String("delta", fmt.Sprintf("%T %+v", entry.Delta, entry.Delta)))
+	}
+
+	config := loadConfig(logger)
+
+	state, err := delta.LoadState(newDiscord(logger))
+	if err != nil {
+		logger.Fatal("failed to load discord state", zap.Error(err))
+	}
+
+	writePlan(logger, out, newPlan(logger, config, state, deltas))
+}
+
+// journaled records the changes made through discord as a new run, unless
+// journaling is disabled, e.g. for a dry run.
+func journaled(logger *zap.Logger, discord delta.Discord, journal *delta.Journal) delta.Discord {
+	if journal == nil {
+		return discord
+	}
+
+	runID := delta.NewRunID()
+
+	logger.Info("journaling discord changes", zap.String("run-id", runID))
+
+	return delta.Journaled{
+		Discord: discord,
+		Journal: journal,
+		RunID:   runID,
+	}
+}
+
+func newDiscord(logger *zap.Logger) delta.Discord {
+	token := os.Getenv("DISCORD_TOKEN")
+	if token == "" {
+		logger.Fatal("no $DISCORD_TOKEN provided")
+	}
+
+	discord, err := delta.NewDiscord(guildID, token)
+	if err != nil {
+		logger.Fatal("failed to initialize discord", zap.Error(err))
+	}
+
+	if os.Getenv("DISCORD_DRY_RUN") != "" {
+		logger.Info("performing discord dry run")
+
+		discord = dryRunDiscord{discord}
+	}
+
+	return discord
+}
+
+// flagSet reports whether the flag was given on the command line.
+func flagSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
+	})
+
+	return set
+}
+
+func loadConfig(logger *zap.Logger) *governance.Config {
+	config, err := governance.LoadConfig(os.DirFS("."))
+	if err != nil {
+		logger.Fatal("failed to load config", zap.Error(err))
 	}
+
+	return config
 }
 
 type dryRunDiscord struct {
@@ -65,6 +517,45 @@ type dryRunDiscord struct {
 
 func (discord dryRunDiscord) CreateRole(delta.DeltaRoleCreate) error          { return nil }
 func (discord dryRunDiscord) EditRole(delta.DeltaRoleEdit) error              { return nil }
+func (discord dryRunDiscord) DeleteRole(delta.DeltaRoleDelete) error          { return nil }
 func (discord dryRunDiscord) SetRolePositions(delta.DeltaRolePositions) error { return nil }
+func (discord dryRunDiscord) CreateChannel(delta.DeltaChannelCreate) error    { return nil }
+func (discord dryRunDiscord) EditChannel(delta.DeltaChannelEdit) error        { return nil }
+func (discord dryRunDiscord) DeleteChannel(delta.DeltaChannelDelete) error    { return nil }
 func (discord dryRunDiscord) AddUserRole(delta.DeltaUserAddRole) error        { return nil }
 func (discord dryRunDiscord) RemoveUserRole(delta.DeltaUserRemoveRole) error  { return nil }
+func (discord dryRunDiscord) SetNickname(delta.DeltaUserNickname) error       { return nil }
+
+type dryRunGitHub struct {
+	ghdelta.GitHub
+}
+
+func (github dryRunGitHub) CreateRepo(ghdelta.DeltaRepoCreate) error                 { return nil }
+func (github dryRunGitHub) UpdateRepo(ghdelta.DeltaRepoUpdate) error                 { return nil }
+func (github dryRunGitHub) CreateTeam(ghdelta.DeltaTeamCreate) error                 { return nil }
+func (github dryRunGitHub) UpdateTeam(ghdelta.DeltaTeamUpdate) error                 { return nil }
+func (github dryRunGitHub) AddMember(ghdelta.DeltaMemberAdd) error                   { return nil }
+func (github dryRunGitHub) AddTeamMember(ghdelta.DeltaTeamMemberAdd) error           { return nil }
+func (github dryRunGitHub) RemoveTeamMember(ghdelta.DeltaTeamMemberRemove) error     { return nil }
+func (github dryRunGitHub) AddTeamRepo(ghdelta.DeltaTeamRepoAdd) error               { return nil }
+func (github dryRunGitHub) RemoveTeamRepo(ghdelta.DeltaTeamRepoRemove) error         { return nil }
+func (github dryRunGitHub) AddCollaborator(ghdelta.DeltaCollaboratorAdd) error       { return nil }
+func (github dryRunGitHub) RemoveCollaborator(ghdelta.DeltaCollaboratorRemove) error { return nil }
+func (github dryRunGitHub) CreateDeployKey(ghdelta.DeltaDeployKeyCreate) error       { return nil }
+func (github dryRunGitHub) DeleteDeployKey(ghdelta.DeltaDeployKeyDelete) error       { return nil }
+
+func (github dryRunGitHub) UpsertBranchProtection(ghdelta.DeltaBranchProtectionUpsert) error {
+	return nil
+}
+
+func (github dryRunGitHub) DeleteBranchProtection(ghdelta.DeltaBranchProtectionDelete) error {
+	return nil
+}
+
+type dryRunMailgun struct {
+	mgdelta.Mailgun
+}
+
+func (mailgun dryRunMailgun) CreateRoute(mgdelta.DeltaRouteCreate) error { return nil }
+func (mailgun dryRunMailgun) UpdateRoute(mgdelta.DeltaRouteUpdate) error { return nil }
+func (mailgun dryRunMailgun) DeleteRoute(mgdelta.DeltaRouteDelete) error { return nil }
@@ -0,0 +1,66 @@
+package mgdelta
+
+import (
+	"github.com/concourse/governance"
+	"go.uber.org/zap"
+)
+
+type Delta interface {
+	Apply(*zap.Logger, Mailgun) error
+}
+
+type DeltaRouteCreate struct {
+	Route governance.MailgunRoute
+}
+
+func (delta DeltaRouteCreate) Apply(logger *zap.Logger, mailgun Mailgun) error {
+	logger.Info("creating route",
+		zap.String("description", delta.Route.Description),
+		zap.String("expression", delta.Route.Expression),
+		zap.Strings("actions", delta.Route.Actions))
+
+	return mailgun.CreateRoute(delta)
+}
+
+// routes are independent of each other
+func (delta DeltaRouteCreate) Provides() []string  { return nil }
+func (delta DeltaRouteCreate) DependsOn() []string { return nil }
+
+// DeltaRouteUpdate sets the expression and actions of an existing route.
+type DeltaRouteUpdate struct {
+	ID    string
+	Route governance.MailgunRoute
+}
+
+func (delta DeltaRouteUpdate) Apply(logger *zap.Logger, mailgun Mailgun) error {
+	logger.Info("updating route",
+		zap.String("id", delta.ID),
+		zap.String("description", delta.Route.Description),
+		zap.String("expression", delta.Route.Expression),
+		zap.Strings("actions", delta.Route.Actions))
+
+	return mailgun.UpdateRoute(delta)
+}
+
+func (delta DeltaRouteUpdate) Provides() []string  { return nil }
+func (delta DeltaRouteUpdate) DependsOn() []string { return nil }
+
+type DeltaRouteDelete struct {
+	ID          string
+	Description string
+}
+
+func (delta DeltaRouteDelete) Apply(logger *zap.Logger, mailgun Mailgun) error {
+	logger.Info("deleting route",
+		zap.String("id", delta.ID),
+		zap.String("description", delta.Description))
+
+	return mailgun.DeleteRoute(delta)
+}
+
+func (delta DeltaRouteDelete) RemovalSubject() string {
+	return delta.Description
+}
+
+func (delta DeltaRouteDelete) Provides() []string  { return nil }
+func (delta DeltaRouteDelete) DependsOn() []string { return nil }
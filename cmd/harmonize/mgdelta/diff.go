@@ -0,0 +1,73 @@
+package mgdelta
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/concourse/governance"
+)
+
+// managedPrefix is the description shared by every route created for a team.
+// Routes without it belong to something else and are never deleted.
+const managedPrefix = "mailgun_route.routes["
+
+// Diff computes the deltas necessary to bring the domain's routes in line
+// with the config. Routes are matched by description.
+func Diff(config *governance.Config, domain string, mailgun Mailgun) ([]Delta, error) {
+	actual, err := mailgun.State()
+	if err != nil {
+		return nil, fmt.Errorf("get state: %w", err)
+	}
+
+	return DiffState(*config.DesiredMailgunState(domain), *actual), nil
+}
+
+// DiffState computes the deltas necessary to go from a previously loaded
+// state to the desired state.
+func DiffState(desired, actual governance.MailgunState) []Delta {
+	var deltas []Delta
+
+	updated := map[string]bool{}
+	for _, change := range governance.DiffMailgun(desired, actual) {
+		switch c := change.(type) {
+		case governance.MailgunRouteMissing:
+			route, _ := desired.Route(c.Description)
+			deltas = append(deltas, DeltaRouteCreate{Route: route})
+
+		case governance.MailgunRouteFieldMismatch:
+			if updated[c.Description] {
+				continue
+			}
+
+			updated[c.Description] = true
+
+			route, _ := desired.Route(c.Description)
+			existing, _ := actual.Route(c.Description)
+			deltas = append(deltas, DeltaRouteUpdate{
+				ID:    existing.ID,
+				Route: route,
+			})
+
+		case governance.MailgunRouteUnexpected:
+			if !strings.HasPrefix(c.Description, managedPrefix) {
+				continue
+			}
+
+			deltas = append(deltas, DeltaRouteDelete{
+				ID:          c.ID,
+				Description: c.Description,
+			})
+		}
+	}
+
+	// create and update before deleting, so mail for a team being renamed
+	// keeps flowing
+	sort.SliceStable(deltas, func(i, j int) bool {
+		_, iDelete := deltas[i].(DeltaRouteDelete)
+		_, jDelete := deltas[j].(DeltaRouteDelete)
+		return !iDelete && jDelete
+	})
+
+	return deltas
+}
@@ -0,0 +1,141 @@
+package mgdelta_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/mgdelta"
+	"github.com/concourse/governance/mailguntest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const domain = "concourse-ci.org"
+const apiKey = "some-key"
+
+var config = &governance.Config{
+	Contributors: map[string]governance.Person{
+		"alice": {
+			Name:   "alice",
+			GitHub: "alice",
+			Email:  "alice@example.com",
+		},
+	},
+	Teams: map[string]governance.Team{
+		"core": {
+			Name:       "core",
+			RawMembers: []string{"alice"},
+		},
+		"security": {
+			Name:       "security",
+			RawMembers: []string{"alice"},
+		},
+	},
+}
+
+var unmanagedRoute = governance.MailgunRoute{
+	ID:          "catch-all-id",
+	Description: "catch-all",
+	Expression:  "catch_all()",
+	Actions:     []string{`forward("root@example.com")`},
+}
+
+func TestSynced(t *testing.T) {
+	server := mailguntest.NewServer(apiKey, append(
+		config.DesiredMailgunState(domain).Routes,
+		unmanagedRoute,
+	))
+	defer server.Close()
+
+	diff, err := mgdelta.Diff(config, domain, newMailgun(t, server))
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func TestRoutes(t *testing.T) {
+	server := mailguntest.NewServer(apiKey, []governance.MailgunRoute{
+		{
+			ID:          "old-id",
+			Description: `mailgun_route.routes["old"]`,
+			Expression:  `match_recipient("old@concourse-ci.org")`,
+			Actions:     []string{`forward("alice@example.com")`, "stop()"},
+		},
+		{
+			ID:          "core-id",
+			Description: `mailgun_route.routes["core"]`,
+			Expression:  `match_recipient("core@concourse-ci.org")`,
+			Actions:     []string{`forward("bob@example.com")`, "stop()"},
+		},
+		unmanagedRoute,
+	})
+	defer server.Close()
+
+	mailgun := newMailgun(t, server)
+
+	diff, err := mgdelta.Diff(config, domain, mailgun)
+	require.NoError(t, err)
+	require.Equal(t, []mgdelta.Delta{
+		mgdelta.DeltaRouteUpdate{
+			ID: "core-id",
+			Route: governance.MailgunRoute{
+				Description: `mailgun_route.routes["core"]`,
+				Expression:  `match_recipient("core@concourse-ci.org")`,
+				Actions:     []string{`forward("alice@example.com")`, "stop()"},
+			},
+		},
+		mgdelta.DeltaRouteCreate{
+			Route: governance.MailgunRoute{
+				Description: `mailgun_route.routes["security"]`,
+				Expression:  `match_recipient("security@concourse-ci.org")`,
+				Actions:     []string{`forward("alice@example.com")`, "stop()"},
+			},
+		},
+		mgdelta.DeltaRouteDelete{
+			ID:          "old-id",
+			Description: `mailgun_route.routes["old"]`,
+		},
+	}, diff)
+
+	core, observed := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	for i, delta := range diff {
+		err = delta.Apply(logger, mailgun)
+		require.NoError(t, err)
+
+		require.Equal(t, i+1, observed.Len(), "%T did not log its activity", delta)
+	}
+
+	require.Equal(t, []governance.MailgunRoute{
+		{
+			ID:          "core-id",
+			Description: `mailgun_route.routes["core"]`,
+			Expression:  `match_recipient("core@concourse-ci.org")`,
+			Actions:     []string{`forward("alice@example.com")`, "stop()"},
+		},
+		unmanagedRoute,
+		{
+			ID:          "created-route-1",
+			Description: `mailgun_route.routes["security"]`,
+			Expression:  `match_recipient("security@concourse-ci.org")`,
+			Actions:     []string{`forward("alice@example.com")`, "stop()"},
+		},
+	}, server.Routes())
+
+	diff, err = mgdelta.Diff(config, domain, mailgun)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
+
+func newMailgun(t *testing.T, server *mailguntest.Server) mgdelta.Mailgun {
+	mailgun, err := mgdelta.NewMailgun(context.Background(), domain, governance.MailgunOptions{
+		APIKey:  apiKey,
+		BaseURL: server.BaseURL(),
+	})
+	require.NoError(t, err)
+
+	return mailgun
+}
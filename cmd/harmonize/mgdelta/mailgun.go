@@ -0,0 +1,78 @@
+package mgdelta
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/concourse/governance"
+	mg "github.com/mailgun/mailgun-go/v4"
+)
+
+type Mailgun interface {
+	State() (*governance.MailgunState, error)
+
+	CreateRoute(DeltaRouteCreate) error
+	UpdateRoute(DeltaRouteUpdate) error
+	DeleteRoute(DeltaRouteDelete) error
+}
+
+type mailgun struct {
+	ctx    context.Context
+	domain string
+	opts   governance.MailgunOptions
+	client *mg.MailgunImpl
+}
+
+func NewMailgun(ctx context.Context, domain string, opts governance.MailgunOptions) (Mailgun, error) {
+	client, err := governance.NewMailgunClient(domain, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailgun{
+		ctx:    ctx,
+		domain: domain,
+		opts:   opts,
+		client: client,
+	}, nil
+}
+
+func (mailgun *mailgun) State() (*governance.MailgunState, error) {
+	return governance.LoadMailgunStateWithOptions(mailgun.ctx, mailgun.domain, mailgun.opts)
+}
+
+func (mailgun *mailgun) CreateRoute(delta DeltaRouteCreate) error {
+	_, err := mailgun.client.CreateRoute(mailgun.ctx, mg.Route{
+		Priority:    0,
+		Description: delta.Route.Description,
+		Expression:  delta.Route.Expression,
+		Actions:     delta.Route.Actions,
+	})
+	if err != nil {
+		return fmt.Errorf("create route: %w", err)
+	}
+
+	return nil
+}
+
+func (mailgun *mailgun) UpdateRoute(delta DeltaRouteUpdate) error {
+	_, err := mailgun.client.UpdateRoute(mailgun.ctx, delta.ID, mg.Route{
+		Description: delta.Route.Description,
+		Expression:  delta.Route.Expression,
+		Actions:     delta.Route.Actions,
+	})
+	if err != nil {
+		return fmt.Errorf("update route: %w", err)
+	}
+
+	return nil
+}
+
+func (mailgun *mailgun) DeleteRoute(delta DeltaRouteDelete) error {
+	err := mailgun.client.DeleteRoute(mailgun.ctx, delta.ID)
+	if err != nil {
+		return fmt.Errorf("delete route: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package mgdelta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/concourse/governance"
+	mg "github.com/mailgun/mailgun-go/v4"
+	"go.uber.org/zap"
+)
+
+// Provider synchronizes a Mailgun domain's routes as a governance.Provider.
+type Provider struct {
+	Domain  string
+	Mailgun Mailgun
+}
+
+func (provider Provider) Name() string {
+	return "mailgun"
+}
+
+func (provider Provider) Load(context.Context) (governance.ProviderState, error) {
+	state, err := provider.Mailgun.State()
+	if err != nil {
+		return nil, err
+	}
+
+	return *state, nil
+}
+
+func (provider Provider) Desired(config *governance.Config) (governance.ProviderState, error) {
+	return *config.DesiredMailgunState(provider.Domain), nil
+}
+
+func (provider Provider) Diff(desired, actual governance.ProviderState) ([]governance.ProviderDelta, error) {
+	desiredState, ok := desired.(governance.MailgunState)
+	if !ok {
+		return nil, fmt.Errorf("unexpected desired state: %T", desired)
+	}
+
+	actualState, ok := actual.(governance.MailgunState)
+	if !ok {
+		return nil, fmt.Errorf("unexpected actual state: %T", actual)
+	}
+
+	deltas := DiffState(desiredState, actualState)
+
+	providerDeltas := make([]governance.ProviderDelta, len(deltas))
+	for i, delta := range deltas {
+		providerDeltas[i] = delta
+	}
+
+	return providerDeltas, nil
+}
+
+func (provider Provider) Apply(_ context.Context, logger *zap.Logger, providerDelta governance.ProviderDelta) error {
+	delta, ok := providerDelta.(Delta)
+	if !ok {
+		return fmt.Errorf("unexpected delta: %T", providerDelta)
+	}
+
+	return classify(delta.Apply(logger, provider.Mailgun))
+}
+
+// classify marks rate limits and server errors as retryable.
+func classify(err error) error {
+	var resErr *mg.UnexpectedResponseError
+	if errors.As(err, &resErr) && (resErr.Actual == http.StatusTooManyRequests || resErr.Actual >= 500) {
+		return governance.Retryable(err)
+	}
+
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/cmd/harmonize/delta"
+	"go.uber.org/zap"
+)
+
+// watch applies each member's deltas as soon as they join or change, with a
+// full run every interval to catch anything else.
+//
+// Unlike the other modes, failures are logged rather than fatal so that a
+// single bad run doesn't stop the watch.
+func watch(ctx context.Context, logger *zap.Logger, opts options, interval time.Duration) {
+	watcher := &delta.Watcher{
+		Logger:    logger.Named("watch"),
+		Runner:    newApplier(logger, opts),
+		Nicknames: opts.nicknames,
+	}
+
+	reconcile := func() {
+		// a new client every time, since its snapshot would otherwise miss
+		// changes made outside of the watch
+		discord := journaled(logger, newDiscord(logger), opts.journal)
+
+		runner := newRunner(ctx, logger, discord, opts)
+
+		// reloaded every time to pick up changes to the checkout
+		config, err := governance.LoadConfig(os.DirFS("."))
+		if err != nil {
+			logger.Error("failed to load config", zap.Error(err))
+			return
+		}
+
+		err = runner.Run(ctx, config)
+		if err != nil {
+			refuse(logger, err)
+			report(logger, err)
+			logger.Error("failed to harmonize", zap.Error(err))
+		}
+
+		state, err := delta.LoadState(discord)
+		if err != nil {
+			logger.Error("failed to load discord state", zap.Error(err))
+			return
+		}
+
+		watcher.Discord = discord
+		watcher.Reset(config, state)
+	}
+
+	events, err := delta.WatchMembers(ctx, guildID, os.Getenv("DISCORD_TOKEN"))
+	if err != nil {
+		logger.Fatal("failed to watch members", zap.Error(err))
+	}
+
+	reconcile()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reconcile()
+
+		case event := <-events:
+			err := watcher.MemberChanged(ctx, event)
+			if errors.Is(err, delta.ErrUnknownRole) {
+				logger.Info("reconciling early", zap.Error(err))
+				reconcile()
+			} else if err != nil {
+				refuse(logger, err)
+				report(logger, err)
+				logger.Error("failed to sync member",
+					zap.String("user", event.Name),
+					zap.Error(err))
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/concourse/governance"
+)
+
+func main() {
+	config, err := governance.LoadConfig(os.DirFS("."))
+	if err != nil {
+		var decodeErrs governance.ConfigErrors
+		if errors.As(err, &decodeErrs) {
+			fail(decodeErrs)
+		}
+
+		log.Fatalln("failed to load config:", err)
+	}
+
+	errs := config.Validate()
+	if len(errs) > 0 {
+		fail(errs)
+	}
+}
+
+func fail(errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	log.Fatalf("found %d problem(s)", len(errs))
+}
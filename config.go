@@ -1,19 +1,20 @@
 package governance
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"path/filepath"
 	"strings"
-
-	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
 	Contributors map[string]Person
 	Teams        map[string]Team
 	Repos        map[string]Repo
+
+	// roles left behind by removed teams, deleted by harmonize
+	RetiredRoles []RetiredRole
 }
 
 type Person struct {
@@ -22,6 +23,22 @@ type Person struct {
 	Discord string            `yaml:"discord,omitempty"`
 	Email   string            `yaml:"email,omitempty"`
 	Repos   map[string]string `yaml:"repos,omitempty"`
+
+	// grants the organization owner role. this should be kept to the smallest
+	// set of people necessary to administer the organization.
+	Owner bool `yaml:"owner,omitempty"`
+
+	// if set, the contributor's Discord nickname is left alone rather than
+	// set to their name.
+	KeepNickname bool `yaml:"keep_nickname,omitempty"`
+}
+
+func (person Person) OrgRole() OrgRole {
+	if person.Owner {
+		return OrgRoleAdmin
+	}
+
+	return OrgRoleMember
 }
 
 type Team struct {
@@ -33,6 +50,7 @@ type Team struct {
 
 	AllContributors bool     `yaml:"all_contributors"`
 	RawMembers      []string `yaml:"members"`
+	RawMaintainers  []string `yaml:"maintainers,omitempty"`
 
 	RequiresEmail bool `yaml:"requires_email,omitempty"`
 
@@ -53,6 +71,18 @@ func (team Team) Members(cfg *Config) map[string]Person {
 	}
 }
 
+// MemberRole returns the GitHub team role for the given contributor, who must
+// already be a member of the team.
+func (team Team) MemberRole(name string) TeamRole {
+	for _, m := range team.RawMaintainers {
+		if m == name {
+			return TeamRoleMaintainer
+		}
+	}
+
+	return TeamRoleMember
+}
+
 func (team Team) RepoPermission() RepoPermission {
 	if team.RawRepoPermission == "" {
 		return RepoPermissionMaintain
@@ -66,48 +96,137 @@ type Discord struct {
 	Color    int    `yaml:"color,omitempty"`
 	Priority int    `yaml:"priority,omitempty"`
 
+	// ID of the team's role. If set, the role is found by ID rather than by
+	// name, so changing Role renames it instead of creating a new one.
+	RoleID string `yaml:"role_id,omitempty"`
+
+	// whether the role's members are listed separately and whether anyone may
+	// mention the role. if unset, new roles get both and existing roles are
+	// left as they are.
+	Hoist       *bool `yaml:"hoist,omitempty"`
+	Mentionable *bool `yaml:"mentionable,omitempty"`
+
+	// a unicode emoji shown as the role's icon. only takes effect if the
+	// server has been boosted enough to allow role icons.
+	Emoji string `yaml:"emoji,omitempty"`
+
 	AddedPermissions DiscordPermissionSet `yaml:"added_permissions,omitempty"`
 
 	// if set, the role will never be removed. this is primarily to
 	// grandfather in users who have roles which predated the governance
 	// automation, i.e. the 'contributors' role.
 	Sticky bool `yaml:"sticky,omitempty"`
+
+	// private channels for the team, grouped under a category. only the
+	// team's role may see them.
+	Channels []DiscordChannel `yaml:"channels,omitempty"`
+
+	// name of the category holding the channels. defaults to the team name.
+	Category string `yaml:"category,omitempty"`
+}
+
+// RetiredRole records a Discord role whose team has been removed, so that
+// harmonize deletes it. Only roles listed here or belonging to a team are ever
+// managed.
+type RetiredRole struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name,omitempty"`
+}
+
+type DiscordChannelType string
+
+const DiscordChannelText DiscordChannelType = "text"
+const DiscordChannelVoice DiscordChannelType = "voice"
+const DiscordChannelCategory DiscordChannelType = "category"
+
+type DiscordChannel struct {
+	// text channel names must be lowercase without spaces, as Discord would
+	// otherwise rename them.
+	Name  string             `yaml:"name"`
+	Type  DiscordChannelType `yaml:"type,omitempty"`
+	Topic string             `yaml:"topic,omitempty"`
+}
+
+// ChannelType defaults to a text channel.
+func (channel DiscordChannel) ChannelType() DiscordChannelType {
+	if channel.Type == "" {
+		return DiscordChannelText
+	}
+
+	return channel.Type
+}
+
+// CategoryName is the name of the category holding the team's channels.
+func (team Team) CategoryName() string {
+	if team.Discord.Category != "" {
+		return team.Discord.Category
+	}
+
+	return team.Name
 }
 
 // 1. copied from https://discord.com/developers/docs/topics/permissions#permissions-bitwise-permission-flags
 // 2. replaced GUILD with SERVER
 var DiscordPermissions = map[string]int64{
-	"CREATE_INSTANT_INVITE": 0x00000001,
-	"KICK_MEMBERS":          0x00000002,
-	"BAN_MEMBERS":           0x00000004,
-	"ADMINISTRATOR":         0x00000008,
-	"MANAGE_CHANNELS":       0x00000010,
-	"MANAGE_SERVER":         0x00000020,
-	"ADD_REACTIONS":         0x00000040,
-	"VIEW_AUDIT_LOG":        0x00000080,
-	"PRIORITY_SPEAKER":      0x00000100,
-	"STREAM":                0x00000200,
-	"VIEW_CHANNEL":          0x00000400,
-	"SEND_MESSAGES":         0x00000800,
-	"SEND_TTS_MESSAGES":     0x00001000,
-	"MANAGE_MESSAGES":       0x00002000,
-	"EMBED_LINKS":           0x00004000,
-	"ATTACH_FILES":          0x00008000,
-	"READ_MESSAGE_HISTORY":  0x00010000,
-	"MENTION_EVERYONE":      0x00020000,
-	"USE_EXTERNAL_EMOJIS":   0x00040000,
-	"VIEW_SERVER_INSIGHTS":  0x00080000,
-	"CONNECT":               0x00100000,
-	"SPEAK":                 0x00200000,
-	"MUTE_MEMBERS":          0x00400000,
-	"DEAFEN_MEMBERS":        0x00800000,
-	"MOVE_MEMBERS":          0x01000000,
-	"USE_VAD":               0x02000000,
-	"CHANGE_NICKNAME":       0x04000000,
-	"MANAGE_NICKNAMES":      0x08000000,
-	"MANAGE_ROLES":          0x10000000,
-	"MANAGE_WEBHOOKS":       0x20000000,
-	"MANAGE_EMOJIS":         0x40000000,
+	"CREATE_INSTANT_INVITE":               1 << 0,
+	"KICK_MEMBERS":                        1 << 1,
+	"BAN_MEMBERS":                         1 << 2,
+	"ADMINISTRATOR":                       1 << 3,
+	"MANAGE_CHANNELS":                     1 << 4,
+	"MANAGE_SERVER":                       1 << 5,
+	"ADD_REACTIONS":                       1 << 6,
+	"VIEW_AUDIT_LOG":                      1 << 7,
+	"PRIORITY_SPEAKER":                    1 << 8,
+	"STREAM":                              1 << 9,
+	"VIEW_CHANNEL":                        1 << 10,
+	"SEND_MESSAGES":                       1 << 11,
+	"SEND_TTS_MESSAGES":                   1 << 12,
+	"MANAGE_MESSAGES":                     1 << 13,
+	"EMBED_LINKS":                         1 << 14,
+	"ATTACH_FILES":                        1 << 15,
+	"READ_MESSAGE_HISTORY":                1 << 16,
+	"MENTION_EVERYONE":                    1 << 17,
+	"USE_EXTERNAL_EMOJIS":                 1 << 18,
+	"VIEW_SERVER_INSIGHTS":                1 << 19,
+	"CONNECT":                             1 << 20,
+	"SPEAK":                               1 << 21,
+	"MUTE_MEMBERS":                        1 << 22,
+	"DEAFEN_MEMBERS":                      1 << 23,
+	"MOVE_MEMBERS":                        1 << 24,
+	"USE_VAD":                             1 << 25,
+	"CHANGE_NICKNAME":                     1 << 26,
+	"MANAGE_NICKNAMES":                    1 << 27,
+	"MANAGE_ROLES":                        1 << 28,
+	"MANAGE_WEBHOOKS":                     1 << 29,
+	"MANAGE_SERVER_EXPRESSIONS":           1 << 30,
+	"USE_APPLICATION_COMMANDS":            1 << 31,
+	"REQUEST_TO_SPEAK":                    1 << 32,
+	"MANAGE_EVENTS":                       1 << 33,
+	"MANAGE_THREADS":                      1 << 34,
+	"CREATE_PUBLIC_THREADS":               1 << 35,
+	"CREATE_PRIVATE_THREADS":              1 << 36,
+	"USE_EXTERNAL_STICKERS":               1 << 37,
+	"SEND_MESSAGES_IN_THREADS":            1 << 38,
+	"USE_EMBEDDED_ACTIVITIES":             1 << 39,
+	"MODERATE_MEMBERS":                    1 << 40,
+	"VIEW_CREATOR_MONETIZATION_ANALYTICS": 1 << 41,
+	"USE_SOUNDBOARD":                      1 << 42,
+	"CREATE_SERVER_EXPRESSIONS":           1 << 43,
+	"CREATE_EVENTS":                       1 << 44,
+	"USE_EXTERNAL_SOUNDS":                 1 << 45,
+	"SEND_VOICE_MESSAGES":                 1 << 46,
+	"SET_VOICE_CHANNEL_STATUS":            1 << 48,
+	"SEND_POLLS":                          1 << 49,
+	"USE_EXTERNAL_APPS":                   1 << 50,
+	"PIN_MESSAGES":                        1 << 51,
+	"BYPASS_SLOWMODE":                     1 << 52,
+}
+
+// previous names of permissions which Discord has since renamed
+var discordPermissionAliases = map[string]string{
+	"MANAGE_EMOJIS":              "MANAGE_SERVER_EXPRESSIONS",
+	"MANAGE_EMOJIS_AND_STICKERS": "MANAGE_SERVER_EXPRESSIONS",
+	"START_EMBEDDED_ACTIVITIES":  "USE_EMBEDDED_ACTIVITIES",
 }
 
 // defaults copied from newly created role; may be worth tuning later
@@ -116,6 +235,10 @@ type DiscordPermissionSet []string
 func (set DiscordPermissionSet) Permissions() (int64, error) {
 	var permissions int64
 	for _, permission := range set {
+		if name, found := discordPermissionAliases[permission]; found {
+			permission = name
+		}
+
 		bits, found := DiscordPermissions[permission]
 		if !found {
 			return 0, fmt.Errorf("unknown permission: %s", permission)
@@ -127,6 +250,32 @@ func (set DiscordPermissionSet) Permissions() (int64, error) {
 	return permissions, nil
 }
 
+// DiscordPermissionNames decodes permission bits into their names, ordered by
+// bit. Bits without a known name are included in hex.
+func DiscordPermissionNames(permissions int64) DiscordPermissionSet {
+	bitNames := map[int64]string{}
+	for name, bits := range DiscordPermissions {
+		bitNames[bits] = name
+	}
+
+	names := DiscordPermissionSet{}
+	for bit := 0; bit < 64; bit++ {
+		bits := int64(1) << bit
+		if permissions&bits == 0 {
+			continue
+		}
+
+		name, found := bitNames[bits]
+		if !found {
+			name = fmt.Sprintf("0x%x", uint64(bits))
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
 var TeamRoleBasePermissions = DiscordPermissionSet{
 	"VIEW_CHANNEL",
 	"CREATE_INSTANT_INVITE",
@@ -196,6 +345,8 @@ type RepoDeployKey struct {
 }
 
 func LoadConfig(tree fs.FS) (*Config, error) {
+	var errs ConfigErrors
+
 	personFiles, err := fs.ReadDir(tree, "contributors")
 	if err != nil {
 		return nil, err
@@ -211,9 +362,10 @@ func LoadConfig(tree fs.FS) (*Config, error) {
 		}
 
 		var person Person
-		err = decode(file, &person)
-		if err != nil {
-			return nil, fmt.Errorf("decode %s: %w", fn, err)
+		decodeErrs := decode(fn, file, &person)
+		if len(decodeErrs) > 0 {
+			errs = append(errs, decodeErrs...)
+			continue
 		}
 
 		contributors[strings.TrimSuffix(f.Name(), ".yml")] = person
@@ -234,9 +386,10 @@ func LoadConfig(tree fs.FS) (*Config, error) {
 		}
 
 		var team Team
-		err = decode(file, &team)
-		if err != nil {
-			return nil, fmt.Errorf("decode %s: %w", fn, err)
+		decodeErrs := decode(fn, file, &team)
+		if len(decodeErrs) > 0 {
+			errs = append(errs, decodeErrs...)
+			continue
 		}
 
 		teams[strings.TrimSuffix(f.Name(), ".yml")] = team
@@ -257,21 +410,39 @@ func LoadConfig(tree fs.FS) (*Config, error) {
 		}
 
 		var repo Repo
-		err = decode(file, &repo)
-		if err != nil {
-			return nil, fmt.Errorf("decode %s: %w", fn, err)
+		decodeErrs := decode(fn, file, &repo)
+		if len(decodeErrs) > 0 {
+			errs = append(errs, decodeErrs...)
+			continue
 		}
 
 		repos[strings.TrimSuffix(f.Name(), ".yml")] = repo
 	}
 
+	var retiredRoles []RetiredRole
+	file, err := tree.Open(retiredRolesFile)
+	if err == nil {
+		errs = append(errs, decode(retiredRolesFile, file, &retiredRoles)...)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return &Config{
 		Contributors: contributors,
 		Teams:        teams,
 		Repos:        repos,
+		RetiredRoles: retiredRoles,
 	}, nil
 }
 
+// retiredRolesFile is optional, as there may be no removed teams to clean up
+// after.
+const retiredRolesFile = "discord/retired_roles.yml"
+
 // collapse word-wrapped string YAML blocks
 func sanitize(str string) string {
 	return strings.TrimSpace(strings.Join(strings.Split(str, "\n"), " "))
@@ -294,7 +465,9 @@ func permission3to4(v3permission string) RepoPermission {
 	}
 }
 
-func permission4to3(v4permission RepoPermission) string {
+// Permission4to3 converts a GraphQL (v4) repo permission to the name used by
+// the REST (v3) API.
+func Permission4to3(v4permission RepoPermission) string {
 	switch v4permission {
 	case RepoPermissionRead:
 		return "pull"
@@ -310,9 +483,3 @@ func permission4to3(v4permission RepoPermission) string {
 		return "invalid"
 	}
 }
-
-func decode(stream io.Reader, dest interface{}) error {
-	dec := yaml.NewDecoder(stream)
-	dec.SetStrict(true)
-	return dec.Decode(dest)
-}
@@ -1,8 +1,11 @@
 package governance_test
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/concourse/governance"
 	"github.com/stretchr/testify/require"
@@ -24,3 +27,177 @@ func TestMemberEmails(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	tree := fstest.MapFS{
+		"contributors/alice.yml": {Data: []byte("name: Alice\ngithub: alice\nrepos: {bogus: push}\n")},
+		"contributors/bob.yml":   {Data: []byte("name: Bob\ngithub: Alice\n")},
+		"teams/core.yml": {Data: []byte(`name: core
+purpose: core things
+members: [alice, alice, carol]
+maintainers: [bob]
+repo_permission: write
+repos: [concourse, missing]
+discord:
+  added_permissions: [NOT_A_PERMISSION]
+  role_id: "1234"
+  channels:
+  - name: general
+  - name: Off Topic
+  - name: Not Allowed
+  - name: general
+    type: voice
+  - name: stage
+    type: stage
+`)},
+		"teams/infra.yml": {Data: []byte(`name: infra
+purpose: infra things
+members: [alice]
+discord:
+  role_id: "1234"
+`)},
+		"repos/concourse.yml": {Data: []byte("name: concourse\ndescription: ci\n")},
+		"repos/other.yml":     {Data: []byte("name: renamed\ndescription: other\n")},
+		"discord/retired_roles.yml": {Data: []byte(`- id: "1234"
+  name: core-team
+- id: "5678"
+- id: "5678"
+- name: old-team
+`)},
+	}
+
+	config, err := governance.LoadConfig(tree)
+	require.NoError(t, err)
+
+	var messages []string
+	for _, err := range config.Validate() {
+		messages = append(messages, err.Error())
+	}
+
+	require.Equal(t, []string{
+		`repos/other.yml: name: "renamed" does not match file name`,
+		`contributors/alice.yml: repos: unknown repo "bogus"`,
+		`contributors/bob.yml: github: "Alice" does not match file name`,
+		`contributors/bob.yml: github: "Alice" is already used by contributors/alice.yml`,
+		`contributors: owner: no contributor is an organization owner`,
+		`teams/core.yml: members: "alice" is listed more than once`,
+		`teams/core.yml: members: unknown contributor "carol"`,
+		`teams/core.yml: maintainers: "bob" is not a member of the team`,
+		`teams/core.yml: repo_permission: invalid permission "write"`,
+		`teams/core.yml: repos: unknown repo "missing"`,
+		`teams/core.yml: discord.added_permissions: unknown permission: NOT_A_PERMISSION`,
+		`teams/core.yml: discord.channels: invalid text channel name "Off Topic"`,
+		`teams/core.yml: discord.channels: invalid text channel name "Not Allowed"`,
+		`teams/core.yml: discord.channels: "general" is listed more than once`,
+		`teams/core.yml: discord.channels: invalid type "stage" for channel "stage"`,
+		`teams/infra.yml: discord.role_id: "1234" is already used by teams/core.yml`,
+		`discord/retired_roles.yml: id: "1234" is still used by teams/core.yml`,
+		`discord/retired_roles.yml: id: "5678" is listed more than once`,
+		`discord/retired_roles.yml: id: must not be empty`,
+	}, messages)
+}
+
+func TestValidateConfig(t *testing.T) {
+	config, err := governance.LoadConfig(os.DirFS("."))
+	require.NoError(t, err)
+	require.Empty(t, config.Validate())
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tree := fstest.MapFS{
+		"contributors/alice.yml": {Data: []byte("name: Alice\ngithub: alice\ngihtub: typo\nowner: [yes]\n")},
+		"contributors/bob.yml":   {Data: []byte("name: Bob\ngithub: [bob]\n")},
+		"teams/core.yml": {Data: []byte(`name: core
+purpose: core things
+repo_permisson: maintain
+discord:
+  colour: 0x123456
+  totally_unrelated: true
+`)},
+		"repos/concourse.yml": {Data: []byte("name: concourse\ndescription: ci\n  bad: indent\n")},
+	}
+
+	_, err := governance.LoadConfig(tree)
+	require.Error(t, err)
+
+	var errs governance.ConfigErrors
+	require.True(t, errors.As(err, &errs))
+
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	require.Equal(t, []string{
+		`contributors/alice.yml:3:1: "gihtub" is not a valid field (did you mean "github"?)`,
+		`contributors/alice.yml:4:8: cannot unmarshal !!seq into bool`,
+		`contributors/bob.yml:2:9: cannot unmarshal !!seq into string`,
+		`teams/core.yml:3:1: "repo_permisson" is not a valid field (did you mean "repo_permission"?)`,
+		`teams/core.yml:5:3: discord: "colour" is not a valid field (did you mean "color"?)`,
+		`teams/core.yml:6:3: discord: "totally_unrelated" is not a valid field`,
+		`repos/concourse.yml:3:1: mapping values are not allowed in this context`,
+	}, messages)
+}
+
+func TestDecodeInline(t *testing.T) {
+	type common struct {
+		Name string `yaml:"name"`
+	}
+
+	type labeled struct {
+		common `yaml:",inline"`
+
+		Color  int               `yaml:"color"`
+		Labels map[string]string `yaml:",inline"`
+	}
+
+	type strict struct {
+		common `yaml:",inline"`
+
+		Color int `yaml:"color"`
+	}
+
+	var dest labeled
+	errs := governance.Decode("labeled.yml", strings.NewReader("name: core\ncolor: 1\nteam: core\n"), &dest)
+	require.Empty(t, errs)
+	require.Equal(t, labeled{
+		common: common{Name: "core"},
+		Color:  1,
+		Labels: map[string]string{"team": "core"},
+	}, dest)
+
+	errs = governance.Decode("strict.yml", strings.NewReader("name: core\ncolr: 1\n"), &strict{})
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `strict.yml:2:1: "colr" is not a valid field (did you mean "color"?)`)
+}
+
+func TestDiscordPermissions(t *testing.T) {
+	permissions, err := governance.DiscordPermissionSet{
+		"VIEW_CHANNEL",
+		"MANAGE_THREADS",
+		"MODERATE_MEMBERS",
+		"MANAGE_EMOJIS",
+	}.Permissions()
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<10|1<<30|1<<34|1<<40), permissions)
+
+	recent, err := governance.DiscordPermissionSet{
+		"SET_VOICE_CHANNEL_STATUS",
+		"PIN_MESSAGES",
+		"BYPASS_SLOWMODE",
+	}.Permissions()
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<48|1<<51|1<<52), recent)
+
+	require.Equal(t, governance.DiscordPermissionSet{
+		"VIEW_CHANNEL",
+		"MANAGE_SERVER_EXPRESSIONS",
+		"MANAGE_THREADS",
+		"MODERATE_MEMBERS",
+		"0x800000000000",
+	}, governance.DiscordPermissionNames(permissions|1<<47))
+
+	for name, bits := range governance.DiscordPermissions {
+		require.Equal(t, governance.DiscordPermissionSet{name}, governance.DiscordPermissionNames(bits))
+	}
+}
@@ -0,0 +1,306 @@
+package governance
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlUnknownField matches the decoder's own unknown field errors, which
+// checkFields already reports with a suggestion.
+var yamlUnknownField = regexp.MustCompile(`^field .* not found in type `)
+
+// decode strictly decodes a single YAML document into dest, returning every
+// problem found along with its position in the file.
+func decode(fn string, stream io.Reader, dest interface{}) []error {
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		return []error{ConfigError{File: fn, Message: err.Error()}}
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return []error{positionedError(fn, err.Error())}
+	}
+
+	if doc.Kind == 0 {
+		// empty file
+		return nil
+	}
+
+	errs := checkFields(fn, &doc, reflect.TypeOf(dest), "")
+
+	err = doc.Decode(dest)
+	if err != nil {
+		if terr, ok := err.(*yaml.TypeError); ok {
+			for _, msg := range terr.Errors {
+				cerr := positionedError(fn, msg)
+				if yamlUnknownField.MatchString(cerr.Message) {
+					continue
+				}
+
+				cerr.Column = lineColumn(&doc, cerr.Line)
+				errs = append(errs, cerr)
+			}
+		} else {
+			errs = append(errs, positionedError(fn, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func positionedError(fn string, msg string) ConfigError {
+	match := yamlLinePrefix.FindStringSubmatch(msg)
+	if match == nil {
+		return ConfigError{File: fn, Message: msg}
+	}
+
+	line, _ := strconv.Atoi(match[1])
+
+	return ConfigError{
+		File:    fn,
+		Line:    line,
+		Column:  1,
+		Message: match[2],
+	}
+}
+
+// lineColumn returns the column of the value on the given line, since type
+// errors only report the line.
+func lineColumn(node *yaml.Node, line int) int {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Line == line {
+				if value.Line == line {
+					return value.Column
+				}
+
+				return key.Column
+			}
+		}
+	}
+
+	if node.Line == line && node.Kind != yaml.DocumentNode {
+		return node.Column
+	}
+
+	for _, child := range node.Content {
+		if column := lineColumn(child, line); column > 0 {
+			return column
+		}
+	}
+
+	return 0
+}
+
+// checkFields walks the YAML node tree alongside the destination type,
+// reporting any mapping keys that do not correspond to a struct field.
+func checkFields(fn string, node *yaml.Node, typ reflect.Type, path string) []error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		var errs []error
+		for _, child := range node.Content {
+			errs = append(errs, checkFields(fn, child, typ, path)...)
+		}
+
+		return errs
+
+	case yaml.AliasNode:
+		return checkFields(fn, node.Alias, typ, path)
+
+	case yaml.SequenceNode:
+		if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+			return nil
+		}
+
+		var errs []error
+		for _, child := range node.Content {
+			errs = append(errs, checkFields(fn, child, typ.Elem(), path)...)
+		}
+
+		return errs
+
+	case yaml.MappingNode:
+		var errs []error
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			switch typ.Kind() {
+			case reflect.Map:
+				errs = append(errs, checkFields(fn, value, typ.Elem(), joinField(path, key.Value))...)
+
+			case reflect.Struct:
+				fields, rest := yamlFields(typ)
+
+				field, found := fields[key.Value]
+				if !found && rest != nil {
+					// collected by an inline map
+					errs = append(errs, checkFields(fn, value, rest.Elem(), joinField(path, key.Value))...)
+					continue
+				}
+
+				if !found {
+					msg := strconv.Quote(key.Value) + " is not a valid field"
+					if suggestion := closestField(key.Value, fields); suggestion != "" {
+						msg += " (did you mean " + strconv.Quote(suggestion) + "?)"
+					}
+
+					errs = append(errs, ConfigError{
+						File:    fn,
+						Line:    key.Line,
+						Column:  key.Column,
+						Field:   path,
+						Message: msg,
+					})
+
+					continue
+				}
+
+				errs = append(errs, checkFields(fn, value, field.Type, joinField(path, key.Value))...)
+			}
+		}
+
+		return errs
+	}
+
+	return nil
+}
+
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// yamlFields returns the fields a struct decodes, including those of any
+// inline structs, along with the type of its inline map, if it has one.
+func yamlFields(typ reflect.Type) (map[string]reflect.StructField, reflect.Type) {
+	fields := map[string]reflect.StructField{}
+	var rest reflect.Type
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// unexported
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+
+		if hasOption(tag[1:], "inline") {
+			inline := field.Type
+			for inline.Kind() == reflect.Ptr {
+				inline = inline.Elem()
+			}
+
+			if inline.Kind() == reflect.Map {
+				rest = inline
+				continue
+			}
+
+			inlineFields, inlineRest := yamlFields(inline)
+			for name, field := range inlineFields {
+				fields[name] = field
+			}
+
+			if inlineRest != nil {
+				rest = inlineRest
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field
+	}
+
+	return fields, rest
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closestField suggests the field name most similar to the given unknown
+// one, if any are close enough to plausibly be a typo.
+func closestField(name string, fields map[string]reflect.StructField) string {
+	var best string
+	bestDistance := len(name)/3 + 1
+
+	for candidate := range fields {
+		distance := levenshtein(name, candidate)
+		if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	min := a
+	if b < min {
+		min = b
+	}
+
+	if c < min {
+		min = c
+	}
+
+	return min
+}
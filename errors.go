@@ -0,0 +1,7 @@
+package governance
+
+import "errors"
+
+// ErrMissingCredentials is returned when a state loader is not given any way
+// to authenticate with its API.
+var ErrMissingCredentials = errors.New("missing credentials")
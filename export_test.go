@@ -0,0 +1,4 @@
+package governance
+
+// Decode exposes decode to the governance_test package.
+var Decode = decode
@@ -2,7 +2,7 @@ resource "github_membership" "contributors" {
   for_each = local.contributors
 
   username = each.value.github
-  role     = "member"
+  role     = try(each.value.owner, false) ? "admin" : "member"
 }
 
 resource "github_team" "teams" {
@@ -0,0 +1,701 @@
+package governance
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// GitHubChange is a single difference between the desired and actual state of
+// a GitHub organization.
+type GitHubChange interface {
+	// Target identifies the object that has drifted.
+	Target() GitHubTarget
+
+	// String describes the change in a human-readable form.
+	String() string
+}
+
+type GitHubTargetKind string
+
+const GitHubTargetOrganization GitHubTargetKind = "organization"
+const GitHubTargetTeam GitHubTargetKind = "team"
+const GitHubTargetRepo GitHubTargetKind = "repo"
+
+type GitHubTarget struct {
+	Kind GitHubTargetKind
+	Name string
+}
+
+type GitHubMemberMissing struct {
+	Login string
+	Role  OrgRole
+}
+
+func (change GitHubMemberMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetOrganization}
+}
+
+func (change GitHubMemberMissing) String() string {
+	return fmt.Sprintf("%s should be a member of the organization, but is not", change.Login)
+}
+
+type GitHubMemberUnexpected struct {
+	Login string
+	Role  OrgRole
+}
+
+func (change GitHubMemberUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetOrganization}
+}
+
+func (change GitHubMemberUnexpected) String() string {
+	return fmt.Sprintf("%s should not be a member (role %s)", change.Login, change.Role)
+}
+
+type GitHubMemberRoleChanged struct {
+	Login   string
+	Desired OrgRole
+	Actual  OrgRole
+}
+
+func (change GitHubMemberRoleChanged) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetOrganization}
+}
+
+func (change GitHubMemberRoleChanged) String() string {
+	return fmt.Sprintf("%s has role %s, should be %s", change.Login, change.Actual, change.Desired)
+}
+
+type GitHubTeamMissing struct {
+	Team string
+}
+
+func (change GitHubTeamMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamMissing) String() string {
+	return "team does not exist"
+}
+
+type GitHubTeamUnexpected struct {
+	Team string
+}
+
+func (change GitHubTeamUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamUnexpected) String() string {
+	return "team should not exist"
+}
+
+type GitHubTeamFieldMismatch struct {
+	Team    string
+	Field   string
+	Desired interface{}
+	Actual  interface{}
+}
+
+func (change GitHubTeamFieldMismatch) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamFieldMismatch) String() string {
+	return fmt.Sprintf("%s is %#v, should be %#v", change.Field, change.Actual, change.Desired)
+}
+
+type GitHubTeamMemberMissing struct {
+	Team  string
+	Login string
+	Role  TeamRole
+}
+
+func (change GitHubTeamMemberMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamMemberMissing) String() string {
+	return fmt.Sprintf("%s should be a member of the %s team, but is not", change.Login, change.Team)
+}
+
+type GitHubTeamMemberUnexpected struct {
+	Team  string
+	Login string
+	Role  TeamRole
+}
+
+func (change GitHubTeamMemberUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamMemberUnexpected) String() string {
+	return fmt.Sprintf("%s should not be a member of the %s team", change.Login, change.Team)
+}
+
+type GitHubTeamMemberRoleChanged struct {
+	Team    string
+	Login   string
+	Desired TeamRole
+	Actual  TeamRole
+}
+
+func (change GitHubTeamMemberRoleChanged) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamMemberRoleChanged) String() string {
+	return fmt.Sprintf("%s has team role %s, should be %s", change.Login, change.Actual, change.Desired)
+}
+
+type GitHubTeamRepoMissing struct {
+	Team       string
+	Repo       string
+	Permission RepoPermission
+}
+
+func (change GitHubTeamRepoMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamRepoMissing) String() string {
+	return fmt.Sprintf("should have %s access to %s, but does not", change.Permission, change.Repo)
+}
+
+type GitHubTeamRepoUnexpected struct {
+	Team       string
+	Repo       string
+	Permission RepoPermission
+}
+
+func (change GitHubTeamRepoUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamRepoUnexpected) String() string {
+	return fmt.Sprintf("should not have %s access to %s", change.Permission, change.Repo)
+}
+
+type GitHubTeamRepoPermissionChanged struct {
+	Team    string
+	Repo    string
+	Desired RepoPermission
+	Actual  RepoPermission
+}
+
+func (change GitHubTeamRepoPermissionChanged) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetTeam, Name: change.Team}
+}
+
+func (change GitHubTeamRepoPermissionChanged) String() string {
+	return fmt.Sprintf("has %s access to %s, should be %s", change.Actual, change.Repo, change.Desired)
+}
+
+type GitHubRepoMissing struct {
+	Repo string
+}
+
+func (change GitHubRepoMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubRepoMissing) String() string {
+	return "repo does not exist"
+}
+
+type GitHubRepoUnexpected struct {
+	Repo string
+}
+
+func (change GitHubRepoUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubRepoUnexpected) String() string {
+	return "repo is not in configuration"
+}
+
+type GitHubRepoWithoutTeam struct {
+	Repo string
+}
+
+func (change GitHubRepoWithoutTeam) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubRepoWithoutTeam) String() string {
+	return "does not belong to any team"
+}
+
+type GitHubRepoFieldMismatch struct {
+	Repo    string
+	Field   string
+	Desired interface{}
+	Actual  interface{}
+}
+
+func (change GitHubRepoFieldMismatch) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubRepoFieldMismatch) String() string {
+	return fmt.Sprintf("%s is %#v, should be %#v", change.Field, change.Actual, change.Desired)
+}
+
+type GitHubCollaboratorMissing struct {
+	Repo       string
+	Login      string
+	Permission RepoPermission
+}
+
+func (change GitHubCollaboratorMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubCollaboratorMissing) String() string {
+	return fmt.Sprintf("%s should be a collaborator with %s access, but is not", change.Login, change.Permission)
+}
+
+type GitHubCollaboratorUnexpected struct {
+	Repo       string
+	Login      string
+	Permission RepoPermission
+}
+
+func (change GitHubCollaboratorUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubCollaboratorUnexpected) String() string {
+	return fmt.Sprintf("%s should not be a collaborator (has %s access)", change.Login, change.Permission)
+}
+
+type GitHubCollaboratorPermissionChanged struct {
+	Repo    string
+	Login   string
+	Desired RepoPermission
+	Actual  RepoPermission
+}
+
+func (change GitHubCollaboratorPermissionChanged) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubCollaboratorPermissionChanged) String() string {
+	return fmt.Sprintf("collaborator %s has %s access, should be %s", change.Login, change.Actual, change.Desired)
+}
+
+type GitHubBranchProtectionMissing struct {
+	Repo    string
+	Pattern string
+}
+
+func (change GitHubBranchProtectionMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubBranchProtectionMissing) String() string {
+	return fmt.Sprintf("branch protection for %s does not exist", change.Pattern)
+}
+
+type GitHubBranchProtectionUnexpected struct {
+	Repo    string
+	Pattern string
+}
+
+func (change GitHubBranchProtectionUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubBranchProtectionUnexpected) String() string {
+	return fmt.Sprintf("branch protection for %s is not in configuration", change.Pattern)
+}
+
+type GitHubBranchProtectionFieldMismatch struct {
+	Repo    string
+	Pattern string
+	Field   string
+	Desired interface{}
+	Actual  interface{}
+}
+
+func (change GitHubBranchProtectionFieldMismatch) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubBranchProtectionFieldMismatch) String() string {
+	return fmt.Sprintf("branch protection for %s: %s is %#v, should be %#v", change.Pattern, change.Field, change.Actual, change.Desired)
+}
+
+type GitHubDeployKeyMissing struct {
+	Repo  string
+	Title string
+}
+
+func (change GitHubDeployKeyMissing) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubDeployKeyMissing) String() string {
+	return fmt.Sprintf("deploy key %q does not exist", change.Title)
+}
+
+type GitHubDeployKeyUnexpected struct {
+	Repo  string
+	Title string
+}
+
+func (change GitHubDeployKeyUnexpected) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubDeployKeyUnexpected) String() string {
+	return fmt.Sprintf("deploy key %q is not in configuration", change.Title)
+}
+
+type GitHubDeployKeyFieldMismatch struct {
+	Repo    string
+	Title   string
+	Field   string
+	Desired interface{}
+	Actual  interface{}
+}
+
+func (change GitHubDeployKeyFieldMismatch) Target() GitHubTarget {
+	return GitHubTarget{Kind: GitHubTargetRepo, Name: change.Repo}
+}
+
+func (change GitHubDeployKeyFieldMismatch) String() string {
+	return fmt.Sprintf("deploy key %q: %s is %#v, should be %#v", change.Title, change.Field, change.Actual, change.Desired)
+}
+
+// DiffGitHub compares the desired state of an organization against its
+// actual state, returning every difference found. Changes are grouped by
+// target: the organization first, then teams and repos by name.
+// Within a target, changes are in the order they were found.
+func DiffGitHub(desired, actual GitHubState) []GitHubChange {
+	var changes []GitHubChange
+
+	for _, member := range desired.Members {
+		actualMember, found := actual.Member(member.Login)
+		if !found {
+			changes = append(changes, GitHubMemberMissing{
+				Login: member.Login,
+				Role:  member.Role,
+			})
+		} else if actualMember.Role != member.Role {
+			changes = append(changes, GitHubMemberRoleChanged{
+				Login:   member.Login,
+				Desired: member.Role,
+				Actual:  actualMember.Role,
+			})
+		}
+	}
+
+	for _, member := range actual.Members {
+		_, found := desired.Member(member.Login)
+		if !found {
+			changes = append(changes, GitHubMemberUnexpected{
+				Login: member.Login,
+				Role:  member.Role,
+			})
+		}
+	}
+
+	for _, desiredTeam := range desired.Teams {
+		actualTeam, found := actual.Team(desiredTeam.Name)
+		if !found {
+			changes = append(changes, GitHubTeamMissing{Team: desiredTeam.Name})
+			continue
+		}
+
+		changes = append(changes, diffTeam(desiredTeam, actualTeam)...)
+	}
+
+	for _, actualTeam := range actual.Teams {
+		_, found := desired.Team(actualTeam.Name)
+		if !found {
+			changes = append(changes, GitHubTeamUnexpected{Team: actualTeam.Name})
+		}
+	}
+
+	for _, desiredRepo := range desired.Repos {
+		var belongs bool
+		for _, team := range desired.Teams {
+			if _, found := team.Repo(desiredRepo.Name); found {
+				belongs = true
+				break
+			}
+		}
+
+		if !belongs {
+			changes = append(changes, GitHubRepoWithoutTeam{Repo: desiredRepo.Name})
+		}
+
+		actualRepo, found := actual.Repo(desiredRepo.Name)
+		if !found {
+			changes = append(changes, GitHubRepoMissing{Repo: desiredRepo.Name})
+			continue
+		}
+
+		changes = append(changes, diffRepo(desiredRepo, actualRepo)...)
+	}
+
+	for _, actualRepo := range actual.Repos {
+		_, found := desired.Repo(actualRepo.Name)
+		if !found {
+			changes = append(changes, GitHubRepoUnexpected{Repo: actualRepo.Name})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i].Target(), changes[j].Target()
+		if a.Kind != b.Kind {
+			return targetKindOrder[a.Kind] < targetKindOrder[b.Kind]
+		}
+
+		return a.Name < b.Name
+	})
+
+	return changes
+}
+
+var targetKindOrder = map[GitHubTargetKind]int{
+	GitHubTargetOrganization: 0,
+	GitHubTargetTeam:         1,
+	GitHubTargetRepo:         2,
+}
+
+func diffTeam(desired, actual GitHubTeam) []GitHubChange {
+	var changes []GitHubChange
+
+	if desired.Description != actual.Description {
+		changes = append(changes, GitHubTeamFieldMismatch{
+			Team:    desired.Name,
+			Field:   "description",
+			Desired: desired.Description,
+			Actual:  actual.Description,
+		})
+	}
+
+	for _, member := range desired.Members {
+		actualMember, found := actual.Member(member.Login)
+		if !found {
+			changes = append(changes, GitHubTeamMemberMissing{
+				Team:  desired.Name,
+				Login: member.Login,
+				Role:  member.Role,
+			})
+		} else if actualMember.Role != member.Role {
+			changes = append(changes, GitHubTeamMemberRoleChanged{
+				Team:    desired.Name,
+				Login:   member.Login,
+				Desired: member.Role,
+				Actual:  actualMember.Role,
+			})
+		}
+	}
+
+	for _, member := range actual.Members {
+		_, found := desired.Member(member.Login)
+		if !found {
+			changes = append(changes, GitHubTeamMemberUnexpected{
+				Team:  desired.Name,
+				Login: member.Login,
+				Role:  member.Role,
+			})
+		}
+	}
+
+	for _, repo := range desired.Repos {
+		actualRepo, found := actual.Repo(repo.Name)
+		if !found {
+			changes = append(changes, GitHubTeamRepoMissing{
+				Team:       desired.Name,
+				Repo:       repo.Name,
+				Permission: repo.Permission,
+			})
+		} else if actualRepo.Permission != repo.Permission {
+			changes = append(changes, GitHubTeamRepoPermissionChanged{
+				Team:    desired.Name,
+				Repo:    repo.Name,
+				Desired: repo.Permission,
+				Actual:  actualRepo.Permission,
+			})
+		}
+	}
+
+	for _, repo := range actual.Repos {
+		_, found := desired.Repo(repo.Name)
+		if !found {
+			changes = append(changes, GitHubTeamRepoUnexpected{
+				Team:       desired.Name,
+				Repo:       repo.Name,
+				Permission: repo.Permission,
+			})
+		}
+	}
+
+	return changes
+}
+
+func diffRepo(desired, actual GitHubRepo) []GitHubChange {
+	var changes []GitHubChange
+
+	field := func(name string, desiredVal, actualVal interface{}) {
+		if !reflect.DeepEqual(desiredVal, actualVal) {
+			changes = append(changes, GitHubRepoFieldMismatch{
+				Repo:    desired.Name,
+				Field:   name,
+				Desired: desiredVal,
+				Actual:  actualVal,
+			})
+		}
+	}
+
+	field("description", desired.Description, actual.Description)
+	field("private", desired.IsPrivate, actual.IsPrivate)
+	field("topics", sortedStrings(desired.Topics), sortedStrings(actual.Topics))
+	field("homepage_url", desired.HomepageURL, actual.HomepageURL)
+	field("has_issues", desired.HasIssues, actual.HasIssues)
+	field("has_projects", desired.HasProjects, actual.HasProjects)
+	field("has_wiki", desired.HasWiki, actual.HasWiki)
+
+	for _, collaborator := range desired.DirectCollaborators {
+		actualCollaborator, found := actual.Collaborator(collaborator.Login)
+		if !found {
+			changes = append(changes, GitHubCollaboratorMissing{
+				Repo:       desired.Name,
+				Login:      collaborator.Login,
+				Permission: collaborator.Permission,
+			})
+		} else if actualCollaborator.Permission != collaborator.Permission {
+			changes = append(changes, GitHubCollaboratorPermissionChanged{
+				Repo:    desired.Name,
+				Login:   collaborator.Login,
+				Desired: collaborator.Permission,
+				Actual:  actualCollaborator.Permission,
+			})
+		}
+	}
+
+	for _, collaborator := range actual.DirectCollaborators {
+		_, found := desired.Collaborator(collaborator.Login)
+		if !found {
+			changes = append(changes, GitHubCollaboratorUnexpected{
+				Repo:       desired.Name,
+				Login:      collaborator.Login,
+				Permission: collaborator.Permission,
+			})
+		}
+	}
+
+	for _, rule := range desired.BranchProtectionRules {
+		actualRule, found := actual.BranchProtectionRule(rule.Pattern)
+		if !found {
+			changes = append(changes, GitHubBranchProtectionMissing{
+				Repo:    desired.Name,
+				Pattern: rule.Pattern,
+			})
+			continue
+		}
+
+		for _, mismatch := range diffBranchProtectionRule(rule, actualRule) {
+			mismatch.Repo = desired.Name
+			changes = append(changes, mismatch)
+		}
+	}
+
+	for _, rule := range actual.BranchProtectionRules {
+		_, found := desired.BranchProtectionRule(rule.Pattern)
+		if !found {
+			changes = append(changes, GitHubBranchProtectionUnexpected{
+				Repo:    desired.Name,
+				Pattern: rule.Pattern,
+			})
+		}
+	}
+
+	for _, key := range desired.DeployKeys {
+		actualKey, found := actual.DeployKey(key.Title)
+		if !found {
+			changes = append(changes, GitHubDeployKeyMissing{
+				Repo:  desired.Name,
+				Title: key.Title,
+			})
+			continue
+		}
+
+		if actualKey.Key != key.Key {
+			changes = append(changes, GitHubDeployKeyFieldMismatch{
+				Repo:    desired.Name,
+				Title:   key.Title,
+				Field:   "public_key",
+				Desired: key.Key,
+				Actual:  actualKey.Key,
+			})
+		}
+
+		if actualKey.ReadOnly != key.ReadOnly {
+			changes = append(changes, GitHubDeployKeyFieldMismatch{
+				Repo:    desired.Name,
+				Title:   key.Title,
+				Field:   "writable",
+				Desired: !key.ReadOnly,
+				Actual:  !actualKey.ReadOnly,
+			})
+		}
+	}
+
+	for _, key := range actual.DeployKeys {
+		_, found := desired.DeployKey(key.Title)
+		if !found {
+			changes = append(changes, GitHubDeployKeyUnexpected{
+				Repo:  desired.Name,
+				Title: key.Title,
+			})
+		}
+	}
+
+	return changes
+}
+
+func diffBranchProtectionRule(desired, actual GitHubRepoBranchProtectionRule) []GitHubBranchProtectionFieldMismatch {
+	var mismatches []GitHubBranchProtectionFieldMismatch
+
+	field := func(name string, desiredVal, actualVal interface{}) {
+		if !reflect.DeepEqual(desiredVal, actualVal) {
+			mismatches = append(mismatches, GitHubBranchProtectionFieldMismatch{
+				Pattern: desired.Pattern,
+				Field:   name,
+				Desired: desiredVal,
+				Actual:  actualVal,
+			})
+		}
+	}
+
+	field("is_admin_enforced", desired.IsAdminEnforced, actual.IsAdminEnforced)
+	field("allows_deletions", desired.AllowsDeletions, actual.AllowsDeletions)
+	field("allows_force_pushes", desired.AllowsForcePushes, actual.AllowsForcePushes)
+	field("requires_status_checks", desired.RequiresStatusChecks, actual.RequiresStatusChecks)
+	field("requires_strict_status_checks", desired.RequiresStrictStatusChecks, actual.RequiresStrictStatusChecks)
+	field("required_status_check_contexts", sortedStrings(desired.RequiredStatusCheckContexts), sortedStrings(actual.RequiredStatusCheckContexts))
+	field("restricts_pushes", desired.RestrictsPushes, actual.RestrictsPushes)
+	field("requires_linear_history", desired.RequiresLinearHistory, actual.RequiresLinearHistory)
+	field("requires_commit_signatures", desired.RequiresCommitSignatures, actual.RequiresCommitSignatures)
+	field("requires_approving_reviews", desired.RequiresApprovingReviews, actual.RequiresApprovingReviews)
+	field("required_approving_review_count", desired.RequiredApprovingReviewCount, actual.RequiredApprovingReviewCount)
+	field("dismisses_stale_reviews", desired.DismissesStaleReviews, actual.DismissesStaleReviews)
+	field("requires_code_owner_reviews", desired.RequiresCodeOwnerReviews, actual.RequiresCodeOwnerReviews)
+	field("restricts_review_dismissals", desired.RestrictsReviewDismissals, actual.RestrictsReviewDismissals)
+
+	return mismatches
+}
+
+// sortedStrings returns a sorted copy, treating nil and empty as equal.
+func sortedStrings(strs []string) []string {
+	sorted := append([]string{}, strs...)
+	sort.Strings(sorted)
+	return sorted
+}
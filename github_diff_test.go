@@ -0,0 +1,154 @@
+package governance_test
+
+import (
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGitHubInSync(t *testing.T) {
+	state := governance.GitHubState{
+		Members: []governance.GitHubOrgMember{
+			{Login: "alice", Role: governance.OrgRoleAdmin},
+		},
+		Teams: []governance.GitHubTeam{
+			{
+				Name:    "core",
+				Members: []governance.GitHubTeamMember{{Login: "alice", Role: governance.TeamRoleMember}},
+				Repos:   []governance.GitHubTeamRepoAccess{{Name: "concourse", Permission: governance.RepoPermissionMaintain}},
+			},
+		},
+		Repos: []governance.GitHubRepo{
+			{
+				Name:   "concourse",
+				Topics: []string{"ci", "go"},
+				BranchProtectionRules: []governance.GitHubRepoBranchProtectionRule{
+					{Pattern: "master", RequiredStatusCheckContexts: []string{"b", "a"}},
+				},
+			},
+		},
+	}
+
+	actual := state
+	actual.Repos = []governance.GitHubRepo{
+		{
+			Name:   "concourse",
+			Topics: []string{"go", "ci"},
+			BranchProtectionRules: []governance.GitHubRepoBranchProtectionRule{
+				{Pattern: "master", RequiredStatusCheckContexts: []string{"a", "b"}},
+			},
+		},
+	}
+
+	require.Empty(t, governance.DiffGitHub(state, actual))
+}
+
+func TestDiffGitHub(t *testing.T) {
+	desired := governance.GitHubState{
+		Members: []governance.GitHubOrgMember{
+			{Login: "alice", Role: governance.OrgRoleAdmin},
+			{Login: "bob", Role: governance.OrgRoleMember},
+		},
+		Teams: []governance.GitHubTeam{
+			{
+				Name:        "core",
+				Description: "core things",
+				Members: []governance.GitHubTeamMember{
+					{Login: "alice", Role: governance.TeamRoleMaintainer},
+					{Login: "bob", Role: governance.TeamRoleMember},
+				},
+				Repos: []governance.GitHubTeamRepoAccess{
+					{Name: "concourse", Permission: governance.RepoPermissionMaintain},
+					{Name: "rfcs", Permission: governance.RepoPermissionMaintain},
+				},
+			},
+			{Name: "new-team"},
+		},
+		Repos: []governance.GitHubRepo{
+			{
+				Name:        "concourse",
+				Description: "ci",
+				DirectCollaborators: []governance.GitHubRepoCollaborator{
+					{Login: "bot", Permission: governance.RepoPermissionWrite},
+				},
+				BranchProtectionRules: []governance.GitHubRepoBranchProtectionRule{
+					{Pattern: "master", RequiredApprovingReviewCount: 1},
+					{Pattern: "release/*"},
+				},
+				DeployKeys: []governance.GitHubDeployKey{
+					{Title: "ci", Key: "ssh-ed25519 AAAA", ReadOnly: true},
+				},
+			},
+			{Name: "orphan"},
+		},
+	}
+
+	actual := governance.GitHubState{
+		Members: []governance.GitHubOrgMember{
+			{Login: "alice", Role: governance.OrgRoleMember},
+			{Login: "mallory", Role: governance.OrgRoleAdmin},
+		},
+		Teams: []governance.GitHubTeam{
+			{
+				Name:        "core",
+				Description: "old description",
+				Members: []governance.GitHubTeamMember{
+					{Login: "alice", Role: governance.TeamRoleMember},
+					{Login: "mallory", Role: governance.TeamRoleMember},
+				},
+				Repos: []governance.GitHubTeamRepoAccess{
+					{Name: "concourse", Permission: governance.RepoPermissionAdmin},
+					{Name: "secret", Permission: governance.RepoPermissionRead},
+				},
+			},
+			{Name: "old-team"},
+		},
+		Repos: []governance.GitHubRepo{
+			{
+				Name:        "concourse",
+				Description: "ci",
+				IsPrivate:   true,
+				DirectCollaborators: []governance.GitHubRepoCollaborator{
+					{Login: "bot", Permission: governance.RepoPermissionAdmin},
+					{Login: "mallory", Permission: governance.RepoPermissionWrite},
+				},
+				BranchProtectionRules: []governance.GitHubRepoBranchProtectionRule{
+					{Pattern: "master", RequiredApprovingReviewCount: 0},
+					{Pattern: "main"},
+				},
+				DeployKeys: []governance.GitHubDeployKey{
+					{Title: "ci", Key: "ssh-ed25519 AAAA", ReadOnly: false},
+					{Title: "stray", Key: "ssh-ed25519 BBBB", ReadOnly: true},
+				},
+			},
+			{Name: "unknown"},
+		},
+	}
+
+	require.Equal(t, []governance.GitHubChange{
+		governance.GitHubMemberRoleChanged{Login: "alice", Desired: governance.OrgRoleAdmin, Actual: governance.OrgRoleMember},
+		governance.GitHubMemberMissing{Login: "bob", Role: governance.OrgRoleMember},
+		governance.GitHubMemberUnexpected{Login: "mallory", Role: governance.OrgRoleAdmin},
+		governance.GitHubTeamFieldMismatch{Team: "core", Field: "description", Desired: "core things", Actual: "old description"},
+		governance.GitHubTeamMemberRoleChanged{Team: "core", Login: "alice", Desired: governance.TeamRoleMaintainer, Actual: governance.TeamRoleMember},
+		governance.GitHubTeamMemberMissing{Team: "core", Login: "bob", Role: governance.TeamRoleMember},
+		governance.GitHubTeamMemberUnexpected{Team: "core", Login: "mallory", Role: governance.TeamRoleMember},
+		governance.GitHubTeamRepoPermissionChanged{Team: "core", Repo: "concourse", Desired: governance.RepoPermissionMaintain, Actual: governance.RepoPermissionAdmin},
+		governance.GitHubTeamRepoMissing{Team: "core", Repo: "rfcs", Permission: governance.RepoPermissionMaintain},
+		governance.GitHubTeamRepoUnexpected{Team: "core", Repo: "secret", Permission: governance.RepoPermissionRead},
+		governance.GitHubTeamMissing{Team: "new-team"},
+		governance.GitHubTeamUnexpected{Team: "old-team"},
+		governance.GitHubRepoFieldMismatch{Repo: "concourse", Field: "private", Desired: false, Actual: true},
+		governance.GitHubCollaboratorPermissionChanged{Repo: "concourse", Login: "bot", Desired: governance.RepoPermissionWrite, Actual: governance.RepoPermissionAdmin},
+		governance.GitHubCollaboratorUnexpected{Repo: "concourse", Login: "mallory", Permission: governance.RepoPermissionWrite},
+		governance.GitHubBranchProtectionFieldMismatch{Repo: "concourse", Pattern: "master", Field: "required_approving_review_count", Desired: 1, Actual: 0},
+		governance.GitHubBranchProtectionMissing{Repo: "concourse", Pattern: "release/*"},
+		governance.GitHubBranchProtectionUnexpected{Repo: "concourse", Pattern: "main"},
+		governance.GitHubDeployKeyFieldMismatch{Repo: "concourse", Title: "ci", Field: "writable", Desired: false, Actual: true},
+		governance.GitHubDeployKeyUnexpected{Repo: "concourse", Title: "stray"},
+		governance.GitHubRepoWithoutTeam{Repo: "orphan"},
+		governance.GitHubRepoMissing{Repo: "orphan"},
+		governance.GitHubRepoUnexpected{Repo: "unknown"},
+	}, governance.DiffGitHub(desired, actual))
+}
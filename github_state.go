@@ -3,10 +3,12 @@ package governance
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/shurcooL/githubv4"
+	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 )
 
@@ -28,19 +30,83 @@ const RepoPermissionRead RepoPermission = "READ"
 const RepoPermissionTriage RepoPermission = "TRIAGE"
 const RepoPermissionWrite RepoPermission = "WRITE"
 
-func LoadGitHubState(orgName string) (*GitHubState, error) {
-	ctx := context.Background()
+// GitHubOptions configures how GitHub state is loaded.
+type GitHubOptions struct {
+	// Token is a personal access token, used when TokenSource is not set.
+	Token string
+
+	// TokenSource provides OAuth2 tokens. If neither it nor Token is set,
+	// HTTPClient must handle authentication itself.
+	TokenSource oauth2.TokenSource
+
+	// HTTPClient is used for all requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// BaseURL is the GraphQL endpoint. Defaults to GitHub's public API.
+	BaseURL string
 
+	// Logger receives progress logs. Defaults to a no-op logger.
+	Logger *zap.Logger
+}
+
+// LoadGitHubState loads the organization's state using $GITHUB_TOKEN.
+func LoadGitHubState(orgName string) (*GitHubState, error) {
 	githubToken := os.Getenv("GITHUB_TOKEN")
 	if githubToken == "" {
-		return nil, fmt.Errorf("no $GITHUB_TOKEN provided")
+		return nil, fmt.Errorf("no $GITHUB_TOKEN provided: %w", ErrMissingCredentials)
 	}
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
+	return LoadGitHubStateWithOptions(context.Background(), orgName, GitHubOptions{
+		Token: githubToken,
+	})
+}
+
+// LoadGitHubStateWithOptions loads the organization's state without relying
+// on the environment. ErrMissingCredentials is returned if no token, token
+// source, or HTTP client is given.
+func LoadGitHubStateWithOptions(ctx context.Context, orgName string, opts GitHubOptions) (*GitHubState, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
-	client := githubv4.NewClient(oauth2.NewClient(ctx, ts))
+	httpClient := opts.HTTPClient
+
+	ts := opts.TokenSource
+	if ts == nil && opts.Token != "" {
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: opts.Token},
+		)
+	}
+
+	if ts != nil {
+		if httpClient != nil {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+		}
+
+		httpClient = oauth2.NewClient(ctx, ts)
+	} else if httpClient == nil {
+		return nil, fmt.Errorf("github: %w", ErrMissingCredentials)
+	}
+
+	var client *githubv4.Client
+	if opts.BaseURL != "" {
+		client = githubv4.NewEnterpriseClient(opts.BaseURL, httpClient)
+	} else {
+		client = githubv4.NewClient(httpClient)
+	}
+
+	return loadGitHubState(ctx, client, orgName, logger)
+}
+
+// LoadGitHubStateWithClient loads the organization's state using the given
+// client, e.g. one pointed at a GitHub Enterprise or fake GraphQL endpoint.
+func LoadGitHubStateWithClient(ctx context.Context, client *githubv4.Client, orgName string) (*GitHubState, error) {
+	return loadGitHubState(ctx, client, orgName, zap.NewNop())
+}
+
+func loadGitHubState(ctx context.Context, client *githubv4.Client, orgName string, logger *zap.Logger) (*GitHubState, error) {
+	logger = logger.With(zap.String("org", orgName))
 
 	org := &GitHubState{
 		Organization: orgName,
@@ -51,16 +117,22 @@ func LoadGitHubState(orgName string) (*GitHubState, error) {
 		return nil, err
 	}
 
+	logger.Debug("loaded members", zap.Int("count", len(org.Members)))
+
 	err = org.LoadTeams(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 
+	logger.Debug("loaded teams", zap.Int("count", len(org.Teams)))
+
 	err = org.LoadRepos(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 
+	logger.Debug("loaded repos", zap.Int("count", len(org.Repos)))
+
 	return org, nil
 }
 
@@ -73,7 +145,7 @@ func (cfg *Config) DesiredGitHubState() GitHubState {
 		state.Members = append(state.Members, GitHubOrgMember{
 			Name:  person.Name,
 			Login: person.GitHub,
-			Role:  OrgRoleMember,
+			Role:  person.OrgRole(),
 		})
 
 		for repo, permission := range person.Repos {
@@ -90,10 +162,10 @@ func (cfg *Config) DesiredGitHubState() GitHubState {
 			Description: sanitize(team.Purpose),
 		}
 
-		for _, member := range team.Members(cfg) {
+		for name, member := range team.Members(cfg) {
 			ghTeam.Members = append(ghTeam.Members, GitHubTeamMember{
 				Login: member.GitHub,
-				Role:  TeamRoleMember,
+				Role:  team.MemberRole(name),
 			})
 		}
 
@@ -169,6 +241,10 @@ type GitHubState struct {
 	Repos   []GitHubRepo
 }
 
+func (state GitHubState) Population() int {
+	return len(state.Members)
+}
+
 func (state GitHubState) Member(login string) (GitHubOrgMember, bool) {
 	for _, member := range state.Members {
 		if member.Login == login {
@@ -276,6 +352,26 @@ func (repo GitHubRepo) Collaborator(login string) (GitHubRepoCollaborator, bool)
 	return GitHubRepoCollaborator{}, false
 }
 
+func (repo GitHubRepo) BranchProtectionRule(pattern string) (GitHubRepoBranchProtectionRule, bool) {
+	for _, rule := range repo.BranchProtectionRules {
+		if rule.Pattern == pattern {
+			return rule, true
+		}
+	}
+
+	return GitHubRepoBranchProtectionRule{}, false
+}
+
+func (repo GitHubRepo) DeployKey(title string) (GitHubDeployKey, bool) {
+	for _, key := range repo.DeployKeys {
+		if key.Title == title {
+			return key, true
+		}
+	}
+
+	return GitHubDeployKey{}, false
+}
+
 type GitHubRepoCollaborator struct {
 	Login      string
 	Permission RepoPermission
@@ -337,15 +433,10 @@ func (state *GitHubState) LoadMembers(ctx context.Context, client *githubv4.Clie
 		}
 
 		for _, edge := range membersQ.Organization.Members.Edges {
-			role := OrgRole(edge.Role)
-			if role == OrgRoleAdmin {
-				continue
-			}
-
 			state.Members = append(state.Members, GitHubOrgMember{
 				Name:  edge.Node.Name,
 				Login: edge.Node.Login,
-				Role:  role,
+				Role:  OrgRole(edge.Role),
 			})
 		}
 
@@ -359,68 +450,201 @@ func (state *GitHubState) LoadMembers(ctx context.Context, client *githubv4.Clie
 	return nil
 }
 
+type pageInfo struct {
+	EndCursor   githubv4.String
+	HasNextPage bool
+}
+
+type teamMemberEdge struct {
+	Role string
+	Node struct {
+		Login string
+	}
+}
+
+type teamRepoEdge struct {
+	Permission string
+	Node       struct {
+		Name string
+	}
+}
+
 func (state *GitHubState) LoadTeams(ctx context.Context, client *githubv4.Client) error {
-	var teamsQ struct {
-		Organization struct {
-			Teams struct {
-				Nodes []struct {
-					Name        string
-					DatabaseId  int
-					Description string
+	args := map[string]interface{}{
+		"org":   githubv4.String(state.Organization),
+		"limit": githubv4.Int(100),
+		"after": (*githubv4.String)(nil),
+	}
 
-					Members struct {
-						Edges []struct {
-							Role string
-							Node struct {
-								Login string
-							}
-						}
-					} `graphql:"members(first: 100)"` // 100 ought to be enough
+	for {
+		var teamsQ struct {
+			Organization struct {
+				Teams struct {
+					Nodes []struct {
+						Name        string
+						Slug        string
+						DatabaseId  int
+						Description string
 
-					Repositories struct {
-						Edges []struct {
-							Permission string
-							Node       struct {
-								Name string
-							}
-						}
-					} `graphql:"repositories(first: 100)"` // 100 ought to be enough
+						Members struct {
+							Edges    []teamMemberEdge
+							PageInfo pageInfo
+						} `graphql:"members(first: 100)"`
+
+						Repositories struct {
+							Edges    []teamRepoEdge
+							PageInfo pageInfo
+						} `graphql:"repositories(first: 100)"`
+					}
+
+					PageInfo pageInfo
+				} `graphql:"teams(first: $limit, after: $after)"`
+			} `graphql:"organization(login: $org)"`
+		}
+		err := client.Query(ctx, &teamsQ, args)
+		if err != nil {
+			return fmt.Errorf("list teams: %w", err)
+		}
+
+		for _, node := range teamsQ.Organization.Teams.Nodes {
+			team := GitHubTeam{
+				ID:          node.DatabaseId,
+				Name:        node.Name,
+				Description: node.Description,
+			}
+
+			memberEdges := node.Members.Edges
+			if node.Members.PageInfo.HasNextPage {
+				more, err := state.loadTeamMembers(ctx, client, node.Slug, node.Members.PageInfo.EndCursor)
+				if err != nil {
+					return err
 				}
-			} `graphql:"teams(first: 100)"` // 100 ought to be enough
-		} `graphql:"organization(login: $org)"`
+
+				memberEdges = append(memberEdges, more...)
+			}
+
+			for _, edge := range memberEdges {
+				team.Members = append(team.Members, GitHubTeamMember{
+					Login: edge.Node.Login,
+					Role:  TeamRole(edge.Role),
+				})
+			}
+
+			repoEdges := node.Repositories.Edges
+			if node.Repositories.PageInfo.HasNextPage {
+				more, err := state.loadTeamRepos(ctx, client, node.Slug, node.Repositories.PageInfo.EndCursor)
+				if err != nil {
+					return err
+				}
+
+				repoEdges = append(repoEdges, more...)
+			}
+
+			for _, edge := range repoEdges {
+				team.Repos = append(team.Repos, GitHubTeamRepoAccess{
+					Name:       edge.Node.Name,
+					Permission: RepoPermission(edge.Permission),
+				})
+			}
+
+			state.Teams = append(state.Teams, team)
+		}
+
+		if !teamsQ.Organization.Teams.PageInfo.HasNextPage {
+			break
+		}
+
+		args["after"] = githubv4.NewString(teamsQ.Organization.Teams.PageInfo.EndCursor)
 	}
-	err := client.Query(ctx, &teamsQ, map[string]interface{}{
-		"org": githubv4.String(state.Organization),
-	})
-	if err != nil {
-		return fmt.Errorf("list teams: %w", err)
+
+	return nil
+}
+
+// loadTeamMembers fetches the remaining pages of a team's members, starting
+// after the given cursor.
+func (state *GitHubState) loadTeamMembers(ctx context.Context, client *githubv4.Client, slug string, after githubv4.String) ([]teamMemberEdge, error) {
+	args := map[string]interface{}{
+		"org":   githubv4.String(state.Organization),
+		"slug":  githubv4.String(slug),
+		"limit": githubv4.Int(100),
+		"after": githubv4.NewString(after),
 	}
 
-	for _, node := range teamsQ.Organization.Teams.Nodes {
-		team := GitHubTeam{
-			ID:          node.DatabaseId,
-			Name:        node.Name,
-			Description: node.Description,
+	var edges []teamMemberEdge
+	for {
+		var membersQ struct {
+			Organization struct {
+				Team struct {
+					Members struct {
+						Edges    []teamMemberEdge
+						PageInfo pageInfo
+					} `graphql:"members(first: $limit, after: $after)"`
+				} `graphql:"team(slug: $slug)"`
+			} `graphql:"organization(login: $org)"`
+		}
+		err := client.Query(ctx, &membersQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list team %s members: %w", slug, err)
 		}
 
-		for _, edge := range node.Members.Edges {
-			team.Members = append(team.Members, GitHubTeamMember{
-				Login: edge.Node.Login,
-				Role:  TeamRole(edge.Role),
-			})
+		edges = append(edges, membersQ.Organization.Team.Members.Edges...)
+
+		if !membersQ.Organization.Team.Members.PageInfo.HasNextPage {
+			return edges, nil
 		}
 
-		for _, edge := range node.Repositories.Edges {
-			team.Repos = append(team.Repos, GitHubTeamRepoAccess{
-				Name:       edge.Node.Name,
-				Permission: RepoPermission(edge.Permission),
-			})
+		args["after"] = githubv4.NewString(membersQ.Organization.Team.Members.PageInfo.EndCursor)
+	}
+}
+
+// loadTeamRepos fetches the remaining pages of a team's repositories,
+// starting after the given cursor.
+func (state *GitHubState) loadTeamRepos(ctx context.Context, client *githubv4.Client, slug string, after githubv4.String) ([]teamRepoEdge, error) {
+	args := map[string]interface{}{
+		"org":   githubv4.String(state.Organization),
+		"slug":  githubv4.String(slug),
+		"limit": githubv4.Int(100),
+		"after": githubv4.NewString(after),
+	}
+
+	var edges []teamRepoEdge
+	for {
+		var reposQ struct {
+			Organization struct {
+				Team struct {
+					Repositories struct {
+						Edges    []teamRepoEdge
+						PageInfo pageInfo
+					} `graphql:"repositories(first: $limit, after: $after)"`
+				} `graphql:"team(slug: $slug)"`
+			} `graphql:"organization(login: $org)"`
+		}
+		err := client.Query(ctx, &reposQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list team %s repos: %w", slug, err)
 		}
 
-		state.Teams = append(state.Teams, team)
+		edges = append(edges, reposQ.Organization.Team.Repositories.Edges...)
+
+		if !reposQ.Organization.Team.Repositories.PageInfo.HasNextPage {
+			return edges, nil
+		}
+
+		args["after"] = githubv4.NewString(reposQ.Organization.Team.Repositories.PageInfo.EndCursor)
 	}
+}
 
-	return nil
+type repoTopicNode struct {
+	Topic struct {
+		Name string
+	}
+}
+
+type repoCollaboratorEdge struct {
+	Permission RepoPermission
+	Node       struct {
+		Login string
+	}
 }
 
 func (state *GitHubState) LoadRepos(ctx context.Context, client *githubv4.Client) error {
@@ -440,12 +664,9 @@ func (state *GitHubState) LoadRepos(ctx context.Context, client *githubv4.Client
 						Description string
 
 						Topics struct {
-							Nodes []struct {
-								Topic struct {
-									Name string
-								}
-							}
-						} `graphql:"repositoryTopics(first: 10)"` // 10 ought to be enough
+							Nodes    []repoTopicNode
+							PageInfo pageInfo
+						} `graphql:"repositoryTopics(first: 100)"`
 
 						HomepageURL string
 
@@ -457,33 +678,28 @@ func (state *GitHubState) LoadRepos(ctx context.Context, client *githubv4.Client
 						HasWikiEnabled     bool
 
 						Collaborators struct {
-							Edges []struct {
-								Permission RepoPermission
-								Node       struct {
-									Login string
-								}
-							}
-						} `graphql:"collaborators(first: 100, affiliation: DIRECT)"` // 100 ought to be enough
+							Edges    []repoCollaboratorEdge
+							PageInfo pageInfo
+						} `graphql:"collaborators(first: 100, affiliation: DIRECT)"`
 
 						BranchProtectionRules struct {
-							Nodes []GitHubRepoBranchProtectionRule
-						} `graphql:"branchProtectionRules(first: 10)"` // 10 ought to be enough
+							Nodes    []GitHubRepoBranchProtectionRule
+							PageInfo pageInfo
+						} `graphql:"branchProtectionRules(first: 100)"`
 
 						DeployKeys struct {
-							Nodes []GitHubDeployKey
-						} `graphql:"deployKeys(first: 10)"` // 10 ought to be enough
+							Nodes    []GitHubDeployKey
+							PageInfo pageInfo
+						} `graphql:"deployKeys(first: 100)"`
 					}
 
-					PageInfo struct {
-						EndCursor   githubv4.String
-						HasNextPage bool
-					}
+					PageInfo pageInfo
 				} `graphql:"repositories(first: $limit, after: $after)"`
 			} `graphql:"organization(login: $org)"`
 		}
 		err := client.Query(ctx, &reposQ, args)
 		if err != nil {
-			if strings.Contains(err.Error(), "Must have push access to view repository collaborators.") {
+			if isCollaboratorAccessError(err) {
 				// swallow error caused by archived repos; reposQ will still be populated
 				// with the response
 			} else {
@@ -508,17 +724,55 @@ func (state *GitHubState) LoadRepos(ctx context.Context, client *githubv4.Client
 				DeployKeys:            node.DeployKeys.Nodes,
 			}
 
-			for _, node := range node.Topics.Nodes {
+			topicNodes := node.Topics.Nodes
+			if node.Topics.PageInfo.HasNextPage {
+				more, err := state.loadRepoTopics(ctx, client, node.Name, node.Topics.PageInfo.EndCursor)
+				if err != nil {
+					return err
+				}
+
+				topicNodes = append(topicNodes, more...)
+			}
+
+			for _, node := range topicNodes {
 				repo.Topics = append(repo.Topics, node.Topic.Name)
 			}
 
-			for _, edge := range node.Collaborators.Edges {
+			collaboratorEdges := node.Collaborators.Edges
+			if node.Collaborators.PageInfo.HasNextPage {
+				more, err := state.loadRepoCollaborators(ctx, client, node.Name, node.Collaborators.PageInfo.EndCursor)
+				if err != nil {
+					return err
+				}
+
+				collaboratorEdges = append(collaboratorEdges, more...)
+			}
+
+			for _, edge := range collaboratorEdges {
 				repo.DirectCollaborators = append(repo.DirectCollaborators, GitHubRepoCollaborator{
 					Login:      edge.Node.Login,
 					Permission: edge.Permission,
 				})
 			}
 
+			if node.BranchProtectionRules.PageInfo.HasNextPage {
+				more, err := state.loadRepoBranchProtectionRules(ctx, client, node.Name, node.BranchProtectionRules.PageInfo.EndCursor)
+				if err != nil {
+					return err
+				}
+
+				repo.BranchProtectionRules = append(repo.BranchProtectionRules, more...)
+			}
+
+			if node.DeployKeys.PageInfo.HasNextPage {
+				more, err := state.loadRepoDeployKeys(ctx, client, node.Name, node.DeployKeys.PageInfo.EndCursor)
+				if err != nil {
+					return err
+				}
+
+				repo.DeployKeys = append(repo.DeployKeys, more...)
+			}
+
 			state.Repos = append(state.Repos, repo)
 		}
 
@@ -531,3 +785,136 @@ func (state *GitHubState) LoadRepos(ctx context.Context, client *githubv4.Client
 
 	return nil
 }
+
+func isCollaboratorAccessError(err error) bool {
+	return strings.Contains(err.Error(), "Must have push access to view repository collaborators.")
+}
+
+func (state *GitHubState) repoArgs(name string, after githubv4.String) map[string]interface{} {
+	return map[string]interface{}{
+		"org":   githubv4.String(state.Organization),
+		"name":  githubv4.String(name),
+		"limit": githubv4.Int(100),
+		"after": githubv4.NewString(after),
+	}
+}
+
+// loadRepoTopics fetches the remaining pages of a repo's topics, starting
+// after the given cursor.
+func (state *GitHubState) loadRepoTopics(ctx context.Context, client *githubv4.Client, name string, after githubv4.String) ([]repoTopicNode, error) {
+	args := state.repoArgs(name, after)
+
+	var nodes []repoTopicNode
+	for {
+		var topicsQ struct {
+			Repository struct {
+				Topics struct {
+					Nodes    []repoTopicNode
+					PageInfo pageInfo
+				} `graphql:"repositoryTopics(first: $limit, after: $after)"`
+			} `graphql:"repository(owner: $org, name: $name)"`
+		}
+		err := client.Query(ctx, &topicsQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list repo %s topics: %w", name, err)
+		}
+
+		nodes = append(nodes, topicsQ.Repository.Topics.Nodes...)
+
+		if !topicsQ.Repository.Topics.PageInfo.HasNextPage {
+			return nodes, nil
+		}
+
+		args["after"] = githubv4.NewString(topicsQ.Repository.Topics.PageInfo.EndCursor)
+	}
+}
+
+// loadRepoCollaborators fetches the remaining pages of a repo's direct
+// collaborators, starting after the given cursor.
+func (state *GitHubState) loadRepoCollaborators(ctx context.Context, client *githubv4.Client, name string, after githubv4.String) ([]repoCollaboratorEdge, error) {
+	args := state.repoArgs(name, after)
+
+	var edges []repoCollaboratorEdge
+	for {
+		var collaboratorsQ struct {
+			Repository struct {
+				Collaborators struct {
+					Edges    []repoCollaboratorEdge
+					PageInfo pageInfo
+				} `graphql:"collaborators(first: $limit, after: $after, affiliation: DIRECT)"`
+			} `graphql:"repository(owner: $org, name: $name)"`
+		}
+		err := client.Query(ctx, &collaboratorsQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list repo %s collaborators: %w", name, err)
+		}
+
+		edges = append(edges, collaboratorsQ.Repository.Collaborators.Edges...)
+
+		if !collaboratorsQ.Repository.Collaborators.PageInfo.HasNextPage {
+			return edges, nil
+		}
+
+		args["after"] = githubv4.NewString(collaboratorsQ.Repository.Collaborators.PageInfo.EndCursor)
+	}
+}
+
+// loadRepoBranchProtectionRules fetches the remaining pages of a repo's branch
+// protection rules, starting after the given cursor.
+func (state *GitHubState) loadRepoBranchProtectionRules(ctx context.Context, client *githubv4.Client, name string, after githubv4.String) ([]GitHubRepoBranchProtectionRule, error) {
+	args := state.repoArgs(name, after)
+
+	var rules []GitHubRepoBranchProtectionRule
+	for {
+		var rulesQ struct {
+			Repository struct {
+				BranchProtectionRules struct {
+					Nodes    []GitHubRepoBranchProtectionRule
+					PageInfo pageInfo
+				} `graphql:"branchProtectionRules(first: $limit, after: $after)"`
+			} `graphql:"repository(owner: $org, name: $name)"`
+		}
+		err := client.Query(ctx, &rulesQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list repo %s branch protection rules: %w", name, err)
+		}
+
+		rules = append(rules, rulesQ.Repository.BranchProtectionRules.Nodes...)
+
+		if !rulesQ.Repository.BranchProtectionRules.PageInfo.HasNextPage {
+			return rules, nil
+		}
+
+		args["after"] = githubv4.NewString(rulesQ.Repository.BranchProtectionRules.PageInfo.EndCursor)
+	}
+}
+
+// loadRepoDeployKeys fetches the remaining pages of a repo's deploy keys,
+// starting after the given cursor.
+func (state *GitHubState) loadRepoDeployKeys(ctx context.Context, client *githubv4.Client, name string, after githubv4.String) ([]GitHubDeployKey, error) {
+	args := state.repoArgs(name, after)
+
+	var keys []GitHubDeployKey
+	for {
+		var keysQ struct {
+			Repository struct {
+				DeployKeys struct {
+					Nodes    []GitHubDeployKey
+					PageInfo pageInfo
+				} `graphql:"deployKeys(first: $limit, after: $after)"`
+			} `graphql:"repository(owner: $org, name: $name)"`
+		}
+		err := client.Query(ctx, &keysQ, args)
+		if err != nil {
+			return nil, fmt.Errorf("list repo %s deploy keys: %w", name, err)
+		}
+
+		keys = append(keys, keysQ.Repository.DeployKeys.Nodes...)
+
+		if !keysQ.Repository.DeployKeys.PageInfo.HasNextPage {
+			return keys, nil
+		}
+
+		args["after"] = githubv4.NewString(keysQ.Repository.DeployKeys.PageInfo.EndCursor)
+	}
+}
@@ -0,0 +1,165 @@
+package governance_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/concourse/governance"
+	"github.com/concourse/governance/githubtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadGitHubStateWithClient(t *testing.T) {
+	// sized to require multiple pages for every connection
+	var org githubtest.Organization
+	org.Organization = "concourse"
+
+	for i := 0; i < 250; i++ {
+		role := governance.OrgRoleMember
+		if i == 0 {
+			role = governance.OrgRoleAdmin
+		}
+
+		org.Members = append(org.Members, governance.GitHubOrgMember{
+			Name:  fmt.Sprintf("Member %d", i),
+			Login: fmt.Sprintf("member-%d", i),
+			Role:  role,
+		})
+	}
+
+	for i := 0; i < 120; i++ {
+		org.Teams = append(org.Teams, governance.GitHubTeam{
+			ID:          i + 1,
+			Name:        fmt.Sprintf("team-%d", i),
+			Description: fmt.Sprintf("team %d", i),
+		})
+	}
+
+	bigTeam := &org.Teams[0]
+	for i := 0; i < 150; i++ {
+		role := governance.TeamRoleMember
+		if i%10 == 0 {
+			role = governance.TeamRoleMaintainer
+		}
+
+		bigTeam.Members = append(bigTeam.Members, governance.GitHubTeamMember{
+			Login: fmt.Sprintf("member-%d", i),
+			Role:  role,
+		})
+	}
+
+	for i := 0; i < 130; i++ {
+		bigTeam.Repos = append(bigTeam.Repos, governance.GitHubTeamRepoAccess{
+			Name:       fmt.Sprintf("repo-%d", i),
+			Permission: governance.RepoPermissionMaintain,
+		})
+	}
+
+	for i := 0; i < 210; i++ {
+		org.Repos = append(org.Repos, governance.GitHubRepo{
+			Name:        fmt.Sprintf("repo-%d", i),
+			Description: fmt.Sprintf("repo %d", i),
+			HomepageURL: "https://concourse-ci.org",
+			HasIssues:   i%2 == 0,
+			HasWiki:     i%3 == 0,
+			HasProjects: i%5 == 0,
+
+			// the API returns empty lists rather than null
+			BranchProtectionRules: []governance.GitHubRepoBranchProtectionRule{},
+			DeployKeys:            []governance.GitHubDeployKey{},
+		})
+	}
+
+	bigRepo := &org.Repos[0]
+	for i := 0; i < 120; i++ {
+		bigRepo.Topics = append(bigRepo.Topics, fmt.Sprintf("topic-%d", i))
+	}
+
+	for i := 0; i < 130; i++ {
+		bigRepo.DirectCollaborators = append(bigRepo.DirectCollaborators, governance.GitHubRepoCollaborator{
+			Login:      fmt.Sprintf("member-%d", i),
+			Permission: governance.RepoPermissionWrite,
+		})
+	}
+
+	for i := 0; i < 105; i++ {
+		bigRepo.BranchProtectionRules = append(bigRepo.BranchProtectionRules, governance.GitHubRepoBranchProtectionRule{
+			Pattern:                      fmt.Sprintf("release/%d.x", i),
+			RequiresStatusChecks:         true,
+			RequiredStatusCheckContexts:  []string{"DCO", "ci/unit"},
+			RequiredApprovingReviewCount: 1,
+		})
+	}
+
+	for i := 0; i < 102; i++ {
+		bigRepo.DeployKeys = append(bigRepo.DeployKeys, governance.GitHubDeployKey{
+			Title:    fmt.Sprintf("key-%d", i),
+			Key:      fmt.Sprintf("ssh-ed25519 AAAA%d", i),
+			ReadOnly: i%2 == 0,
+		})
+	}
+
+	org.ArchivedRepos = []governance.GitHubRepo{
+		{Name: "archived", Description: "old stuff"},
+	}
+
+	server := githubtest.NewServer(org)
+	defer server.Close()
+
+	actual, err := governance.LoadGitHubStateWithClient(context.Background(), server.Client(), "concourse")
+	require.NoError(t, err)
+
+	require.Equal(t, org.GitHubState, *actual)
+}
+
+func TestLoadGitHubStateWithClientUnknownOrg(t *testing.T) {
+	server := githubtest.NewServer(githubtest.Organization{
+		GitHubState: governance.GitHubState{Organization: "concourse"},
+	})
+	defer server.Close()
+
+	_, err := governance.LoadGitHubStateWithClient(context.Background(), server.Client(), "nope")
+	require.Error(t, err)
+}
+
+func TestLoadGitHubStateWithOptions(t *testing.T) {
+	org := githubtest.Organization{
+		GitHubState: governance.GitHubState{
+			Organization: "concourse",
+			Members: []governance.GitHubOrgMember{
+				{Name: "Alice", Login: "alice", Role: governance.OrgRoleAdmin},
+			},
+		},
+	}
+
+	server := githubtest.NewServer(org)
+	server.Token = "some-token"
+	defer server.Close()
+
+	t.Run("without credentials", func(t *testing.T) {
+		_, err := governance.LoadGitHubStateWithOptions(context.Background(), "concourse", governance.GitHubOptions{
+			BaseURL: server.URL,
+		})
+		require.True(t, errors.Is(err, governance.ErrMissingCredentials))
+	})
+
+	t.Run("with the wrong token", func(t *testing.T) {
+		_, err := governance.LoadGitHubStateWithOptions(context.Background(), "concourse", governance.GitHubOptions{
+			Token:   "bogus",
+			BaseURL: server.URL,
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("with a token", func(t *testing.T) {
+		actual, err := governance.LoadGitHubStateWithOptions(context.Background(), "concourse", governance.GitHubOptions{
+			Token:      "some-token",
+			BaseURL:    server.URL,
+			HTTPClient: server.Server.Client(),
+		})
+		require.NoError(t, err)
+		require.Equal(t, org.Members, actual.Members)
+	})
+}
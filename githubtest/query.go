@@ -0,0 +1,259 @@
+package githubtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// field is a single field selection in a parsed GraphQL query.
+type field struct {
+	Name       string
+	Args       map[string]value
+	Selections []field
+}
+
+// value is an argument value; either a literal or a reference to a variable.
+type value struct {
+	Variable string
+	Literal  interface{}
+}
+
+func (val value) resolve(vars map[string]interface{}) interface{} {
+	if val.Variable != "" {
+		return vars[val.Variable]
+	}
+
+	return val.Literal
+}
+
+// parseQuery parses the subset of GraphQL emitted by githubv4: a single
+// anonymous query or mutation with variable definitions and nested field
+// selections with arguments. Aliases, fragments, and directives are not
+// supported.
+func parseQuery(query string) ([]field, error) {
+	p := &parser{tokens: tokenize(query)}
+
+	if p.peek() == "query" || p.peek() == "mutation" {
+		p.next()
+
+		if p.peek() == "(" {
+			// variable types are irrelevant; values arrive in the request body
+			depth := 0
+			for {
+				tok := p.next()
+				if tok == "" {
+					return nil, fmt.Errorf("unterminated variable definitions")
+				}
+
+				if tok == "(" {
+					depth++
+				} else if tok == ")" {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != "" {
+		return nil, fmt.Errorf("unexpected trailing token %q", p.peek())
+	}
+
+	return selections, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+
+	return nil
+}
+
+func (p *parser) selectionSet() ([]field, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []field
+	for {
+		switch p.peek() {
+		case "}":
+			p.next()
+			return fields, nil
+		case ",":
+			p.next()
+			continue
+		case "":
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, f)
+	}
+}
+
+func (p *parser) field() (field, error) {
+	f := field{Name: p.next()}
+	if !isName(f.Name) {
+		return field{}, fmt.Errorf("expected field name, got %q", f.Name)
+	}
+
+	if p.peek() == "(" {
+		p.next()
+
+		f.Args = map[string]value{}
+		for p.peek() != ")" {
+			if p.peek() == "," {
+				p.next()
+				continue
+			}
+
+			name := p.next()
+			if !isName(name) {
+				return field{}, fmt.Errorf("expected argument name, got %q", name)
+			}
+
+			err := p.expect(":")
+			if err != nil {
+				return field{}, err
+			}
+
+			val, err := p.value()
+			if err != nil {
+				return field{}, err
+			}
+
+			f.Args[name] = val
+		}
+
+		p.next()
+	}
+
+	if p.peek() == "{" {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return field{}, err
+		}
+
+		f.Selections = selections
+	}
+
+	return f, nil
+}
+
+func (p *parser) value() (value, error) {
+	tok := p.next()
+	switch {
+	case tok == "$":
+		return value{Variable: p.next()}, nil
+	case strings.HasPrefix(tok, `"`):
+		str, err := strconv.Unquote(tok)
+		if err != nil {
+			return value{}, fmt.Errorf("invalid string %s: %w", tok, err)
+		}
+
+		return value{Literal: str}, nil
+	case tok == "true" || tok == "false":
+		return value{Literal: tok == "true"}, nil
+	case tok == "null":
+		return value{}, nil
+	case isName(tok):
+		// enum value
+		return value{Literal: tok}, nil
+	default:
+		num, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("unsupported value %q", tok)
+		}
+
+		// match the representation of JSON-decoded variables
+		return value{Literal: num}, nil
+	}
+}
+
+func tokenize(query string) []string {
+	var tokens []string
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("{}():,$!", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("{}():,$!\"", runes[j]) {
+				j++
+			}
+
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+
+	return tokens
+}
+
+func isName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+
+	for i, r := range tok {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,421 @@
+// Package githubtest provides an offline fake of the GitHub GraphQL API,
+// serving an in-memory organization for testing LoadGitHubState.
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/concourse/governance"
+	"github.com/shurcooL/githubv4"
+)
+
+// Organization is the in-memory state served by the fake.
+type Organization struct {
+	governance.GitHubState
+
+	// ArchivedRepos are served alongside Repos with isArchived set.
+	ArchivedRepos []governance.GitHubRepo
+}
+
+// Server answers the GraphQL queries made by LoadGitHubState using the
+// configured Organization.
+type Server struct {
+	*httptest.Server
+
+	// Token, if set, must be provided as a bearer token on every request.
+	Token string
+
+	org Organization
+}
+
+// NewServer starts a fake GraphQL endpoint serving the given organization. It
+// must be closed by the caller.
+func NewServer(org Organization) *Server {
+	server := &Server{org: org}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveGraphQL))
+	return server
+}
+
+// Client returns a GraphQL client pointed at the fake.
+func (server *Server) Client() *githubv4.Client {
+	return githubv4.NewEnterpriseClient(server.URL, server.Server.Client())
+}
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+}
+
+type graphqlResponse struct {
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+func (server *Server) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if server.Token != "" && r.Header.Get("Authorization") != "Bearer "+server.Token {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req graphqlRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res graphqlResponse
+
+	data, err := server.execute(req)
+	if err != nil {
+		res.Errors = []graphqlError{{Message: err.Error()}}
+	} else {
+		res.Data = data
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (server *Server) execute(req graphqlRequest) (interface{}, error) {
+	selections, err := parseQuery(req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+
+	return resolveObject(server.root(), selections, req.Variables)
+}
+
+// object is a GraphQL object whose fields are scalars, nested objects, lists,
+// connections, or resolvers taking arguments.
+type object map[string]interface{}
+
+type resolver func(args map[string]interface{}) (interface{}, error)
+
+type connection []edge
+
+type edge struct {
+	fields object
+	node   interface{}
+}
+
+func resolve(val interface{}, f field, vars map[string]interface{}) (interface{}, error) {
+	args := map[string]interface{}{}
+	for name, arg := range f.Args {
+		args[name] = arg.resolve(vars)
+	}
+
+	switch v := val.(type) {
+	case resolver:
+		res, err := v(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return resolve(res, field{Name: f.Name, Selections: f.Selections}, vars)
+
+	case connection:
+		page, err := v.page(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		return resolveObject(page, f.Selections, vars)
+
+	case object:
+		if v == nil {
+			return nil, nil
+		}
+
+		return resolveObject(v, f.Selections, vars)
+
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			res, err := resolve(elem, field{Name: f.Name, Selections: f.Selections}, vars)
+			if err != nil {
+				return nil, err
+			}
+
+			list[i] = res
+		}
+
+		return list, nil
+
+	default:
+		if len(f.Selections) > 0 {
+			return nil, fmt.Errorf("field %s is a scalar and cannot have selections", f.Name)
+		}
+
+		return v, nil
+	}
+}
+
+func resolveObject(obj object, selections []field, vars map[string]interface{}) (interface{}, error) {
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("object fields must have selections")
+	}
+
+	res := map[string]interface{}{}
+	for _, sel := range selections {
+		val, found := obj[sel.Name]
+		if !found {
+			return nil, fmt.Errorf("field %s is not supported by the fake", sel.Name)
+		}
+
+		out, err := resolve(val, sel, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		res[sel.Name] = out
+	}
+
+	return res, nil
+}
+
+// page applies first/after pagination, mirroring GitHub's limit of 100 nodes
+// per page.
+func (conn connection) page(args map[string]interface{}) (object, error) {
+	first, ok := args["first"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("first must be provided")
+	}
+
+	if first < 1 || first > 100 {
+		return nil, fmt.Errorf("first must be between 1 and 100, got %v", first)
+	}
+
+	start := 0
+	if after, ok := args["after"].(string); ok {
+		idx, err := strconv.Atoi(strings.TrimPrefix(after, "cursor:"))
+		if err != nil || !strings.HasPrefix(after, "cursor:") {
+			return nil, fmt.Errorf("invalid cursor %q", after)
+		}
+
+		start = idx + 1
+	}
+
+	end := start + int(first)
+	if end > len(conn) {
+		end = len(conn)
+	}
+
+	if start > end {
+		start = end
+	}
+
+	nodes := []interface{}{}
+	edges := []interface{}{}
+	for _, e := range conn[start:end] {
+		nodes = append(nodes, e.node)
+
+		edgeObj := object{"node": e.node}
+		for k, v := range e.fields {
+			edgeObj[k] = v
+		}
+
+		edges = append(edges, edgeObj)
+	}
+
+	endCursor := ""
+	if end > start {
+		endCursor = fmt.Sprintf("cursor:%d", end-1)
+	}
+
+	return object{
+		"nodes":      nodes,
+		"edges":      edges,
+		"totalCount": len(conn),
+		"pageInfo": object{
+			"endCursor":   endCursor,
+			"hasNextPage": end < len(conn),
+		},
+	}, nil
+}
+
+func (server *Server) root() object {
+	org := server.organization()
+
+	return object{
+		"organization": resolver(func(args map[string]interface{}) (interface{}, error) {
+			if args["login"] != server.org.Organization {
+				return nil, fmt.Errorf("Could not resolve to an Organization with the login of '%v'.", args["login"])
+			}
+
+			return org, nil
+		}),
+
+		"repository": resolver(func(args map[string]interface{}) (interface{}, error) {
+			if args["owner"] != server.org.Organization {
+				return nil, fmt.Errorf("Could not resolve to a Repository with the name '%v/%v'.", args["owner"], args["name"])
+			}
+
+			repos := org["repositories"].(connection)
+			for _, e := range repos {
+				repo := e.node.(object)
+				if repo["name"] == args["name"] {
+					return repo, nil
+				}
+			}
+
+			return nil, fmt.Errorf("Could not resolve to a Repository with the name '%v/%v'.", args["owner"], args["name"])
+		}),
+	}
+}
+
+func (server *Server) organization() object {
+	var members connection
+	for _, member := range server.org.Members {
+		members = append(members, edge{
+			fields: object{"role": string(member.Role)},
+			node: object{
+				"name":  member.Name,
+				"login": member.Login,
+			},
+		})
+	}
+
+	var teams connection
+	teamsBySlug := map[string]object{}
+	for _, team := range server.org.Teams {
+		var teamMembers connection
+		for _, member := range team.Members {
+			teamMembers = append(teamMembers, edge{
+				fields: object{"role": string(member.Role)},
+				node:   object{"login": member.Login},
+			})
+		}
+
+		var teamRepos connection
+		for _, repo := range team.Repos {
+			teamRepos = append(teamRepos, edge{
+				fields: object{"permission": string(repo.Permission)},
+				node:   object{"name": repo.Name},
+			})
+		}
+
+		obj := object{
+			"name":         team.Name,
+			"slug":         Slug(team.Name),
+			"databaseId":   team.ID,
+			"description":  team.Description,
+			"members":      teamMembers,
+			"repositories": teamRepos,
+		}
+
+		teamsBySlug[Slug(team.Name)] = obj
+		teams = append(teams, edge{node: obj})
+	}
+
+	var repos connection
+	for _, repo := range server.org.Repos {
+		repos = append(repos, edge{node: repoObject(repo, false)})
+	}
+
+	for _, repo := range server.org.ArchivedRepos {
+		repos = append(repos, edge{node: repoObject(repo, true)})
+	}
+
+	return object{
+		"login":           server.org.Organization,
+		"membersWithRole": members,
+		"teams":           teams,
+		"team": resolver(func(args map[string]interface{}) (interface{}, error) {
+			slug, _ := args["slug"].(string)
+			return teamsBySlug[slug], nil
+		}),
+		"repositories": repos,
+	}
+}
+
+func repoObject(repo governance.GitHubRepo, archived bool) object {
+	var topics connection
+	for _, topic := range repo.Topics {
+		topics = append(topics, edge{
+			node: object{"topic": object{"name": topic}},
+		})
+	}
+
+	var collaborators connection
+	for _, collaborator := range repo.DirectCollaborators {
+		collaborators = append(collaborators, edge{
+			fields: object{"permission": string(collaborator.Permission)},
+			node:   object{"login": collaborator.Login},
+		})
+	}
+
+	var rules connection
+	for _, rule := range repo.BranchProtectionRules {
+		rules = append(rules, edge{node: structObject(rule)})
+	}
+
+	var keys connection
+	for _, key := range repo.DeployKeys {
+		keys = append(keys, edge{node: structObject(key)})
+	}
+
+	return object{
+		"name":                  repo.Name,
+		"description":           repo.Description,
+		"repositoryTopics":      topics,
+		"homepageUrl":           repo.HomepageURL,
+		"isArchived":            archived,
+		"isPrivate":             repo.IsPrivate,
+		"hasIssuesEnabled":      repo.HasIssues,
+		"hasProjectsEnabled":    repo.HasProjects,
+		"hasWikiEnabled":        repo.HasWiki,
+		"collaborators":         collaborators,
+		"branchProtectionRules": rules,
+		"deployKeys":            keys,
+	}
+}
+
+// structObject converts a struct into an object keyed by its field names in
+// GraphQL casing, as the loader decodes some nodes directly into
+// governance types.
+func structObject(v interface{}) object {
+	obj := object{}
+
+	val := reflect.ValueOf(v)
+	for i := 0; i < val.NumField(); i++ {
+		name := []rune(val.Type().Field(i).Name)
+		name[0] = unicode.ToLower(name[0])
+
+		fieldVal := val.Field(i)
+		if fieldVal.Kind() == reflect.Slice {
+			list := []interface{}{}
+			for j := 0; j < fieldVal.Len(); j++ {
+				list = append(list, fieldVal.Index(j).Interface())
+			}
+
+			obj[string(name)] = list
+		} else {
+			obj[string(name)] = fieldVal.Interface()
+		}
+	}
+
+	return obj
+}
+
+// Slug converts a team name to its URL slug the same way GitHub does for
+// simple names.
+func Slug(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", "-"))
+}
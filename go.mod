@@ -5,11 +5,12 @@ go 1.16
 require (
 	github.com/bwmarrin/discordgo v0.23.2
 	github.com/google/go-github/v35 v35.2.0
-	github.com/mailgun/mailgun-go/v4 v4.5.1 // indirect
+	github.com/mailgun/mailgun-go/v4 v4.5.1
 	github.com/shurcooL/githubv4 v0.0.0-20201206200315-234843c633fa
 	github.com/shurcooL/graphql v0.0.0-20200928012149-18c5c3165e3a // indirect
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/zap v1.16.0
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
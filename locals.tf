@@ -27,7 +27,7 @@ locals {
       for person in(try(team.all_contributors, false) ? keys(local.contributors) : team.members) : {
         team_name = team.name
         username  = try(local.contributors[person].github, "")
-        role      = "member"
+        role      = contains(try(team.maintainers, []), person) ? "maintainer" : "member"
       } if try(local.contributors[person].github, "") != ""
     ]
   ])
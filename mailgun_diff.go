@@ -0,0 +1,109 @@
+package governance
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MailgunChange is a single difference between the desired and actual routes
+// of a Mailgun domain.
+type MailgunChange interface {
+	// Route is the description of the route that has drifted.
+	Route() string
+
+	// String describes the change in a human-readable form.
+	String() string
+}
+
+type MailgunRouteMissing struct {
+	Description string
+}
+
+func (change MailgunRouteMissing) Route() string {
+	return change.Description
+}
+
+func (change MailgunRouteMissing) String() string {
+	return "route is not configured"
+}
+
+type MailgunRouteUnexpected struct {
+	ID          string
+	Description string
+}
+
+func (change MailgunRouteUnexpected) Route() string {
+	return change.Description
+}
+
+func (change MailgunRouteUnexpected) String() string {
+	return fmt.Sprintf("route %s is not desired", change.ID)
+}
+
+type MailgunRouteFieldMismatch struct {
+	Description string
+	Field       string
+	Desired     interface{}
+	Actual      interface{}
+}
+
+func (change MailgunRouteFieldMismatch) Route() string {
+	return change.Description
+}
+
+func (change MailgunRouteFieldMismatch) String() string {
+	return fmt.Sprintf("%s is %#v, should be %#v", change.Field, change.Actual, change.Desired)
+}
+
+// DiffMailgun compares desired routes against actual routes, matching them by
+// description. Changes are sorted by route.
+func DiffMailgun(desired, actual MailgunState) []MailgunChange {
+	var changes []MailgunChange
+
+	for _, desiredRoute := range desired.Routes {
+		actualRoute, found := actual.Route(desiredRoute.Description)
+		if !found {
+			changes = append(changes, MailgunRouteMissing{
+				Description: desiredRoute.Description,
+			})
+			continue
+		}
+
+		if desiredRoute.Expression != actualRoute.Expression {
+			changes = append(changes, MailgunRouteFieldMismatch{
+				Description: desiredRoute.Description,
+				Field:       "expression",
+				Desired:     desiredRoute.Expression,
+				Actual:      actualRoute.Expression,
+			})
+		}
+
+		desiredActions := sortedStrings(desiredRoute.Actions)
+		actualActions := sortedStrings(actualRoute.Actions)
+		if !reflect.DeepEqual(desiredActions, actualActions) {
+			changes = append(changes, MailgunRouteFieldMismatch{
+				Description: desiredRoute.Description,
+				Field:       "actions",
+				Desired:     desiredActions,
+				Actual:      actualActions,
+			})
+		}
+	}
+
+	for _, actualRoute := range actual.Routes {
+		_, found := desired.Route(actualRoute.Description)
+		if !found {
+			changes = append(changes, MailgunRouteUnexpected{
+				ID:          actualRoute.ID,
+				Description: actualRoute.Description,
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Route() < changes[j].Route()
+	})
+
+	return changes
+}
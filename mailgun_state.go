@@ -3,21 +3,53 @@ package governance
 import (
 	"context"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
 
 	"github.com/mailgun/mailgun-go/v4"
+	"go.uber.org/zap"
 )
 
-func LoadMailgunState(domain string) (*MailgunState, error) {
-	ctx := context.Background()
+// MailgunOptions configures how Mailgun state is loaded.
+type MailgunOptions struct {
+	// APIKey is required.
+	APIKey string
+
+	// HTTPClient is used for all requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
 
+	// BaseURL is the API base including its version, e.g. mailgun.APIBaseEU.
+	// Defaults to the US region.
+	BaseURL string
+
+	// Logger receives progress logs. Defaults to a no-op logger.
+	Logger *zap.Logger
+}
+
+// LoadMailgunState loads the domain's routes using $MAILGUN_API_KEY.
+func LoadMailgunState(domain string) (*MailgunState, error) {
 	mailgunAPIKey := os.Getenv("MAILGUN_API_KEY")
 	if mailgunAPIKey == "" {
-		log.Fatalln("no $MAILGUN_API_KEY provided")
+		return nil, fmt.Errorf("no $MAILGUN_API_KEY provided: %w", ErrMissingCredentials)
+	}
+
+	return LoadMailgunStateWithOptions(context.Background(), domain, MailgunOptions{
+		APIKey: mailgunAPIKey,
+	})
+}
+
+// LoadMailgunStateWithOptions loads the domain's routes without relying on
+// the environment. ErrMissingCredentials is returned if no API key is given.
+func LoadMailgunStateWithOptions(ctx context.Context, domain string, opts MailgunOptions) (*MailgunState, error) {
+	mg, err := NewMailgunClient(domain, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	mg := mailgun.NewMailgun(domain, mailgunAPIKey)
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
 	state := &MailgunState{}
 
@@ -35,9 +67,37 @@ func LoadMailgunState(domain string) (*MailgunState, error) {
 		}
 	}
 
+	err = iter.Err()
+	if err != nil {
+		return nil, fmt.Errorf("list routes: %w", err)
+	}
+
+	logger.Debug("loaded routes",
+		zap.String("domain", domain),
+		zap.Int("count", len(state.Routes)))
+
 	return state, nil
 }
 
+// NewMailgunClient constructs a Mailgun API client from the given options.
+func NewMailgunClient(domain string, opts MailgunOptions) (*mailgun.MailgunImpl, error) {
+	if opts.APIKey == "" {
+		return nil, fmt.Errorf("mailgun: %w", ErrMissingCredentials)
+	}
+
+	mg := mailgun.NewMailgun(domain, opts.APIKey)
+
+	if opts.HTTPClient != nil {
+		mg.SetClient(opts.HTTPClient)
+	}
+
+	if opts.BaseURL != "" {
+		mg.SetAPIBase(opts.BaseURL)
+	}
+
+	return mg, nil
+}
+
 func (config *Config) DesiredMailgunState(domain string) *MailgunState {
 	state := &MailgunState{}
 
@@ -77,6 +137,16 @@ type MailgunState struct {
 	Routes []MailgunRoute
 }
 
+func (state MailgunState) Route(description string) (MailgunRoute, bool) {
+	for _, route := range state.Routes {
+		if route.Description == description {
+			return route, true
+		}
+	}
+
+	return MailgunRoute{}, false
+}
+
 type MailgunRoute struct {
 	ID          string
 	Description string
@@ -1,11 +1,15 @@
 package governance_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/concourse/governance"
-	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,33 +24,128 @@ func TestMailgun(t *testing.T) {
 	actual, err := governance.LoadMailgunState(domain)
 	require.NoError(t, err)
 
-	for _, desiredRoute := range desired.Routes {
-		t.Run(desiredRoute.Description, func(t *testing.T) {
-			var found bool
-			for _, actualRoute := range actual.Routes {
-				if actualRoute.Description == desiredRoute.Description {
-					found = true
-					assert.Equal(t, desiredRoute.Expression, actualRoute.Expression)
-					assert.ElementsMatch(t, desiredRoute.Actions, actualRoute.Actions)
-					break
-				}
-			}
-
-			assert.True(t, found, "route is not configured")
-		})
+	for _, change := range governance.DiffMailgun(*desired, *actual) {
+		t.Errorf("%s: %s", change.Route(), change)
 	}
+}
 
-	for _, actualRoute := range actual.Routes {
-		t.Run(actualRoute.Description, func(t *testing.T) {
-			var found bool
-			for _, desiredRoute := range desired.Routes {
-				if desiredRoute.Description == actualRoute.Description {
-					found = true
-					break
-				}
-			}
-
-			assert.True(t, found, "route is not desired")
-		})
+func TestDiffMailgun(t *testing.T) {
+	desired := governance.MailgunState{
+		Routes: []governance.MailgunRoute{
+			{
+				Description: `mailgun_route.routes["core"]`,
+				Expression:  `match_recipient("core@concourse-ci.org")`,
+				Actions:     []string{`forward("a@example.com")`, `forward("b@example.com")`, "stop()"},
+			},
+			{
+				Description: `mailgun_route.routes["security"]`,
+				Expression:  `match_recipient("security@concourse-ci.org")`,
+				Actions:     []string{`forward("a@example.com")`, "stop()"},
+			},
+			{
+				Description: `mailgun_route.routes["new"]`,
+				Expression:  `match_recipient("new@concourse-ci.org")`,
+				Actions:     []string{"stop()"},
+			},
+		},
+	}
+
+	actual := governance.MailgunState{
+		Routes: []governance.MailgunRoute{
+			{
+				ID:          "core-id",
+				Description: `mailgun_route.routes["core"]`,
+				Expression:  `match_recipient("core@concourse-ci.org")`,
+				Actions:     []string{`forward("b@example.com")`, `forward("a@example.com")`, "stop()"},
+			},
+			{
+				ID:          "security-id",
+				Description: `mailgun_route.routes["security"]`,
+				Expression:  `match_recipient("sec@concourse-ci.org")`,
+				Actions:     []string{"stop()"},
+			},
+			{
+				ID:          "old-id",
+				Description: `mailgun_route.routes["old"]`,
+				Expression:  `match_recipient("old@concourse-ci.org")`,
+				Actions:     []string{"stop()"},
+			},
+		},
 	}
+
+	require.Equal(t, []governance.MailgunChange{
+		governance.MailgunRouteMissing{
+			Description: `mailgun_route.routes["new"]`,
+		},
+		governance.MailgunRouteUnexpected{
+			ID:          "old-id",
+			Description: `mailgun_route.routes["old"]`,
+		},
+		governance.MailgunRouteFieldMismatch{
+			Description: `mailgun_route.routes["security"]`,
+			Field:       "expression",
+			Desired:     `match_recipient("security@concourse-ci.org")`,
+			Actual:      `match_recipient("sec@concourse-ci.org")`,
+		},
+		governance.MailgunRouteFieldMismatch{
+			Description: `mailgun_route.routes["security"]`,
+			Field:       "actions",
+			Desired:     []string{`forward("a@example.com")`, "stop()"},
+			Actual:      []string{"stop()"},
+		},
+	}, governance.DiffMailgun(desired, actual))
+}
+
+func TestLoadMailgunStateWithOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, key, _ := r.BasicAuth()
+		if key != "some-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("skip") != "" {
+			fmt.Fprint(w, `{"total_count":1,"items":[]}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"total_count":1,"items":[{
+			"id": "route-id",
+			"description": "mailgun_route.routes[\"core\"]",
+			"expression": "match_recipient(\"core@concourse-ci.org\")",
+			"actions": ["forward(\"alice@example.com\")", "stop()"]
+		}]}`)
+	}))
+	defer server.Close()
+
+	t.Run("without credentials", func(t *testing.T) {
+		_, err := governance.LoadMailgunStateWithOptions(context.Background(), domain, governance.MailgunOptions{
+			BaseURL: server.URL + "/v3",
+		})
+		require.True(t, errors.Is(err, governance.ErrMissingCredentials))
+	})
+
+	t.Run("with an API key", func(t *testing.T) {
+		actual, err := governance.LoadMailgunStateWithOptions(context.Background(), domain, governance.MailgunOptions{
+			APIKey:  "some-key",
+			BaseURL: server.URL + "/v3",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []governance.MailgunRoute{
+			{
+				ID:          "route-id",
+				Description: `mailgun_route.routes["core"]`,
+				Expression:  `match_recipient("core@concourse-ci.org")`,
+				Actions:     []string{`forward("alice@example.com")`, "stop()"},
+			},
+		}, actual.Routes)
+	})
+
+	t.Run("with the wrong API key", func(t *testing.T) {
+		_, err := governance.LoadMailgunStateWithOptions(context.Background(), domain, governance.MailgunOptions{
+			APIKey:  "bogus",
+			BaseURL: server.URL + "/v3",
+		})
+		require.Error(t, err)
+	})
 }
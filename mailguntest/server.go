@@ -0,0 +1,205 @@
+// Package mailguntest provides an offline fake of the Mailgun routes API,
+// serving in-memory routes for testing code that loads or changes them.
+package mailguntest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/concourse/governance"
+)
+
+// Server answers the route requests made by the Mailgun client, keeping
+// track of any changes.
+type Server struct {
+	*httptest.Server
+
+	// APIKey must be provided via basic auth on every request.
+	APIKey string
+
+	lock   sync.Mutex
+	routes []governance.MailgunRoute
+	nextID int
+}
+
+// NewServer starts a fake Mailgun API serving the given routes. It must be
+// closed by the caller.
+func NewServer(apiKey string, routes []governance.MailgunRoute) *Server {
+	server := &Server{
+		APIKey: apiKey,
+		routes: append([]governance.MailgunRoute{}, routes...),
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+
+	return server
+}
+
+// BaseURL is the API base to configure the client with.
+func (server *Server) BaseURL() string {
+	return server.URL + "/v3"
+}
+
+// Routes returns the current routes.
+func (server *Server) Routes() []governance.MailgunRoute {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return append([]governance.MailgunRoute{}, server.routes...)
+}
+
+type route struct {
+	ID          string   `json:"id"`
+	Priority    int      `json:"priority"`
+	Description string   `json:"description"`
+	Expression  string   `json:"expression"`
+	Actions     []string `json:"actions"`
+}
+
+func toJSON(r governance.MailgunRoute) route {
+	return route{
+		ID:          r.ID,
+		Description: r.Description,
+		Expression:  r.Expression,
+		Actions:     r.Actions,
+	}
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	_, key, _ := r.BasicAuth()
+	if key != server.APIKey {
+		http.Error(w, "Forbidden", http.StatusUnauthorized)
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v3")
+
+	switch {
+	case path == "/routes" && r.Method == http.MethodGet:
+		server.list(w, r)
+	case path == "/routes" && r.Method == http.MethodPost:
+		server.create(w, r)
+	case strings.HasPrefix(path, "/routes/") && r.Method == http.MethodPut:
+		server.update(w, r, strings.TrimPrefix(path, "/routes/"))
+	case strings.HasPrefix(path, "/routes/") && r.Method == http.MethodDelete:
+		server.delete(w, strings.TrimPrefix(path, "/routes/"))
+	default:
+		http.Error(w, "not supported by the fake", http.StatusNotFound)
+	}
+}
+
+func (server *Server) list(w http.ResponseWriter, r *http.Request) {
+	skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 100
+	}
+
+	if skip > len(server.routes) {
+		skip = len(server.routes)
+	}
+
+	end := skip + limit
+	if end > len(server.routes) {
+		end = len(server.routes)
+	}
+
+	items := []route{}
+	for _, r := range server.routes[skip:end] {
+		items = append(items, toJSON(r))
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"total_count": len(server.routes),
+		"items":       items,
+	})
+}
+
+func (server *Server) create(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.nextID++
+
+	created := governance.MailgunRoute{
+		ID:          fmt.Sprintf("created-route-%d", server.nextID),
+		Description: r.PostForm.Get("description"),
+		Expression:  r.PostForm.Get("expression"),
+		Actions:     r.PostForm["action"],
+	}
+
+	server.routes = append(server.routes, created)
+
+	writeJSON(w, map[string]interface{}{
+		"message": "Route has been created",
+		"route":   toJSON(created),
+	})
+}
+
+func (server *Server) update(w http.ResponseWriter, r *http.Request, id string) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i, existing := range server.routes {
+		if existing.ID != id {
+			continue
+		}
+
+		if _, found := r.PostForm["description"]; found {
+			existing.Description = r.PostForm.Get("description")
+		}
+
+		if _, found := r.PostForm["expression"]; found {
+			existing.Expression = r.PostForm.Get("expression")
+		}
+
+		if actions, found := r.PostForm["action"]; found {
+			existing.Actions = actions
+		}
+
+		server.routes[i] = existing
+
+		writeJSON(w, toJSON(existing))
+		return
+	}
+
+	http.Error(w, `{"message":"Route not found"}`, http.StatusNotFound)
+}
+
+func (server *Server) delete(w http.ResponseWriter, id string) {
+	for i, existing := range server.routes {
+		if existing.ID != id {
+			continue
+		}
+
+		server.routes = append(server.routes[:i], server.routes[i+1:]...)
+
+		writeJSON(w, map[string]interface{}{
+			"message": "Route has been deleted",
+			"id":      id,
+		})
+		return
+	}
+
+	http.Error(w, `{"message":"Route not found"}`, http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
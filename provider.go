@@ -0,0 +1,432 @@
+package governance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Provider synchronizes a single service, e.g. GitHub or Discord, with the
+// config.
+//
+// States and deltas are opaque to everything but the provider that produced
+// them.
+type Provider interface {
+	// Name identifies the provider in logs.
+	Name() string
+
+	// Load fetches the actual state of the service.
+	Load(context.Context) (ProviderState, error)
+
+	// Desired computes the state the service should be in.
+	Desired(*Config) (ProviderState, error)
+
+	// Diff computes the deltas necessary to go from the actual state to the
+	// desired state.
+	Diff(desired, actual ProviderState) ([]ProviderDelta, error)
+
+	// Apply makes a single change to the service.
+	Apply(context.Context, *zap.Logger, ProviderDelta) error
+}
+
+type ProviderState interface{}
+
+type ProviderDelta interface{}
+
+// Concurrent is implemented by deltas which only depend on other deltas with
+// the same key, e.g. changes to a single member. A run of consecutive
+// Concurrent deltas may be applied concurrently, with deltas sharing a key
+// still applied in order.
+type Concurrent interface {
+	ConcurrencyKey() string
+}
+
+// Dependent is implemented by deltas which know what they depend on, so that
+// a failure only skips the later deltas which need what it would have done.
+type Dependent interface {
+	// Provides lists what the delta creates or renames, e.g. a role.
+	Provides() []string
+
+	// DependsOn lists what the delta needs to exist, e.g. the role it grants.
+	DependsOn() []string
+}
+
+// ProviderPlan is the set of deltas planned for a single provider.
+type ProviderPlan struct {
+	Provider Provider
+	Deltas   []ProviderDelta
+
+	// Population is the number of members in the actual state, if known.
+	Population int
+}
+
+// Runner plans and applies changes across multiple providers.
+type Runner struct {
+	Providers []Provider
+
+	// BlastRadius is checked for every plan before anything is applied.
+	BlastRadius BlastRadius
+
+	// Logger receives progress logs. Defaults to a no-op logger.
+	Logger *zap.Logger
+
+	// Concurrency is how many Concurrent deltas may be applied at once.
+	// Defaults to 1.
+	Concurrency int
+
+	// Retries is how many more times a delta is tried after a RetryableError.
+	Retries int
+
+	// Backoff is how long to wait before the first retry, doubling for each
+	// one after.
+	Backoff time.Duration
+}
+
+// Plan computes the deltas for every provider. Nothing is applied, so a
+// provider that fails to load doesn't leave the others half-applied.
+func (runner Runner) Plan(ctx context.Context, config *Config) ([]ProviderPlan, error) {
+	var plans []ProviderPlan
+	for _, provider := range runner.Providers {
+		logger := runner.logger().Named(provider.Name())
+
+		actual, err := provider.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: load: %w", provider.Name(), err)
+		}
+
+		desired, err := provider.Desired(config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: desired: %w", provider.Name(), err)
+		}
+
+		deltas, err := provider.Diff(desired, actual)
+		if err != nil {
+			return nil, fmt.Errorf("%s: diff: %w", provider.Name(), err)
+		}
+
+		logger.Info("planned", zap.Int("deltas", len(deltas)))
+
+		plan := ProviderPlan{
+			Provider: provider,
+			Deltas:   deltas,
+		}
+
+		if populated, ok := actual.(Populated); ok {
+			plan.Population = populated.Population()
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// Apply applies each plan in order. Nothing is applied if any plan exceeds the
+// BlastRadius.
+//
+// Runs of Concurrent deltas are applied by up to Concurrency workers; every
+// other delta waits for the ones before it.
+//
+// A failed delta doesn't stop the deltas independent of it: a Concurrent delta
+// skips the rest of the deltas with its key, a Dependent delta skips the deltas
+// depending on what it provides, and any other delta skips the rest of its
+// provider's plan. Every failure is returned in an ApplyError.
+//
+// Once the context is done, nothing more is applied.
+func (runner Runner) Apply(ctx context.Context, plans []ProviderPlan) error {
+	for _, plan := range plans {
+		err := runner.BlastRadius.Check(plan)
+		if err != nil {
+			return err
+		}
+	}
+
+	var failures []DeltaFailure
+	for _, plan := range plans {
+		logger := runner.logger().Named(plan.Provider.Name())
+
+		if len(plan.Deltas) == 0 {
+			logger.Info("nothing to do")
+			continue
+		}
+
+		var planFailures []DeltaFailure
+		var applied int
+		failed := failedDeltas{keys: map[string]bool{}, provided: map[string]bool{}}
+		for _, batch := range batches(plan.Deltas) {
+			if ctx.Err() != nil {
+				break
+			}
+
+			batch = failed.prune(batch)
+			if len(batch) == 0 {
+				continue
+			}
+
+			batchApplied, batchFailures := runner.applyBatch(ctx, logger, plan.Provider, batch)
+			applied += batchApplied
+			planFailures = append(planFailures, batchFailures...)
+
+			for _, failure := range batchFailures {
+				failed.record(failure.Delta)
+			}
+
+			if failed.all {
+				break
+			}
+		}
+
+		logger.Info("applied",
+			zap.Int("applied", applied),
+			zap.Int("failed", len(planFailures)),
+			zap.Int("skipped", len(plan.Deltas)-applied-len(planFailures)))
+
+		failures = append(failures, planFailures...)
+	}
+
+	if len(failures) > 0 {
+		return ApplyError{Failures: failures}
+	}
+
+	return ctx.Err()
+}
+
+// applyBatch applies each group of deltas in order, running up to
+// Concurrency groups at once. A failed delta skips the rest of its group.
+// Failures are returned in plan order.
+func (runner Runner) applyBatch(ctx context.Context, logger *zap.Logger, provider Provider, batch [][]ProviderDelta) (int, []DeltaFailure) {
+	workers := runner.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+
+	applied := make([]int, len(batch))
+	failed := make([]*DeltaFailure, len(batch))
+
+	indexes := make(chan int)
+
+	wg := new(sync.WaitGroup)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				for _, delta := range batch[i] {
+					if ctx.Err() != nil {
+						break
+					}
+
+					err := runner.applyDelta(ctx, logger, provider, delta)
+					if err != nil {
+						failed[i] = &DeltaFailure{
+							Provider: provider.Name(),
+							Delta:    delta,
+							Err:      err,
+						}
+
+						break
+					}
+
+					applied[i]++
+				}
+			}
+		}()
+	}
+
+	for i := range batch {
+		indexes <- i
+	}
+
+	close(indexes)
+
+	wg.Wait()
+
+	var total int
+	var failures []DeltaFailure
+	for i := range batch {
+		total += applied[i]
+
+		if failed[i] != nil {
+			failures = append(failures, *failed[i])
+		}
+	}
+
+	return total, failures
+}
+
+// applyDelta applies the delta, retrying with backoff as long as it fails
+// with a RetryableError.
+func (runner Runner) applyDelta(ctx context.Context, logger *zap.Logger, provider Provider, delta ProviderDelta) error {
+	backoff := runner.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := provider.Apply(ctx, logger, delta)
+		if err == nil || !IsRetryable(err) || attempt >= runner.Retries {
+			return err
+		}
+
+		logger.Warn("retrying",
+			zap.String("delta", fmt.Sprintf("%T", delta)),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+	}
+}
+
+// failedDeltas tracks what later deltas can no longer rely on.
+type failedDeltas struct {
+	// keys are the ConcurrencyKeys of failed Concurrent deltas
+	keys map[string]bool
+
+	// provided is everything provided by failed Dependent deltas
+	provided map[string]bool
+
+	// all is set once a delta with unknown dependencies fails
+	all bool
+
+	// any is set once any delta fails
+	any bool
+}
+
+func (failed *failedDeltas) record(delta ProviderDelta) {
+	failed.any = true
+
+	concurrent, isConcurrent := delta.(Concurrent)
+	if isConcurrent {
+		failed.keys[concurrent.ConcurrencyKey()] = true
+	}
+
+	dependent, isDependent := delta.(Dependent)
+	if isDependent {
+		for _, provided := range dependent.Provides() {
+			failed.provided[provided] = true
+		}
+	}
+
+	if !isConcurrent && !isDependent {
+		failed.all = true
+	}
+}
+
+// skips reports whether the delta depends on a failed delta. A delta which is
+// neither Concurrent nor Dependent is assumed to depend on every delta before
+// it.
+func (failed *failedDeltas) skips(delta ProviderDelta) bool {
+	concurrent, isConcurrent := delta.(Concurrent)
+	if isConcurrent && failed.keys[concurrent.ConcurrencyKey()] {
+		return true
+	}
+
+	dependent, isDependent := delta.(Dependent)
+	if isDependent {
+		for _, dependency := range dependent.DependsOn() {
+			if failed.provided[dependency] {
+				return true
+			}
+		}
+	}
+
+	if !isConcurrent && !isDependent {
+		return failed.any
+	}
+
+	return false
+}
+
+// prune removes the deltas which depend on a failed delta from the batch.
+func (failed *failedDeltas) prune(batch [][]ProviderDelta) [][]ProviderDelta {
+	var pruned [][]ProviderDelta
+	for _, group := range batch {
+		var kept []ProviderDelta
+		for _, delta := range group {
+			if !failed.skips(delta) {
+				kept = append(kept, delta)
+			}
+		}
+
+		if len(kept) > 0 {
+			pruned = append(pruned, kept)
+		}
+	}
+
+	return pruned
+}
+
+// batches splits the deltas into batches which must be applied one after
+// another. Each batch is a list of groups that are independent of each other.
+//
+// A delta that isn't Concurrent is a batch of its own. Consecutive Concurrent
+// deltas form one batch, grouped by key in the order the keys first appear.
+func batches(deltas []ProviderDelta) [][][]ProviderDelta {
+	var batches [][][]ProviderDelta
+
+	var batch [][]ProviderDelta
+	groups := map[string]int{}
+
+	flush := func() {
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+
+		batch = nil
+		groups = map[string]int{}
+	}
+
+	for _, delta := range deltas {
+		concurrent, ok := delta.(Concurrent)
+		if !ok {
+			flush()
+			batches = append(batches, [][]ProviderDelta{{delta}})
+			continue
+		}
+
+		key := concurrent.ConcurrencyKey()
+
+		i, found := groups[key]
+		if !found {
+			i = len(batch)
+			groups[key] = i
+			batch = append(batch, nil)
+		}
+
+		batch[i] = append(batch[i], delta)
+	}
+
+	flush()
+
+	return batches
+}
+
+// Run plans and then applies every provider.
+func (runner Runner) Run(ctx context.Context, config *Config) error {
+	plans, err := runner.Plan(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	return runner.Apply(ctx, plans)
+}
+
+func (runner Runner) logger() *zap.Logger {
+	if runner.Logger == nil {
+		return zap.NewNop()
+	}
+
+	return runner.Logger
+}
@@ -0,0 +1,409 @@
+package governance_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/concourse/governance"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRunner(t *testing.T) {
+	config := &governance.Config{
+		Teams: map[string]governance.Team{
+			"a": {Name: "a"},
+			"b": {Name: "b"},
+		},
+	}
+
+	t.Run("plans every provider before applying any", func(t *testing.T) {
+		var events []string
+
+		first := &fakeProvider{name: "first", actual: []string{"a"}, events: &events}
+		second := &fakeProvider{name: "second", actual: []string{}, events: &events}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{first, second},
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"first: load",
+			"second: load",
+			"first: apply b",
+			"second: apply a",
+			"second: apply b",
+		}, events)
+	})
+
+	t.Run("does not apply anything if a provider fails to load", func(t *testing.T) {
+		var events []string
+
+		first := &fakeProvider{name: "first", actual: []string{}, events: &events}
+		second := &fakeProvider{name: "second", loadErr: errors.New("nope"), events: &events}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{first, second},
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.EqualError(t, err, "second: load: nope")
+		require.Equal(t, []string{"first: load", "second: load"}, events)
+	})
+
+	t.Run("skips the rest of a provider's plan after a failed delta", func(t *testing.T) {
+		var events []string
+
+		first := &fakeProvider{name: "first", actual: []string{}, applyErr: errors.New("nope"), events: &events}
+		second := &fakeProvider{name: "second", actual: []string{}, applyErr: errors.New("also nope"), events: &events}
+		third := &fakeProvider{name: "third", actual: []string{}, events: &events}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{first, second, third},
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.EqualError(t, err, "2 deltas failed to apply")
+		require.Equal(t, []string{
+			"first: load",
+			"second: load",
+			"third: load",
+			"first: apply a",
+			"second: apply a",
+			"third: apply a",
+			"third: apply b",
+		}, events)
+
+		var applyErr governance.ApplyError
+		require.True(t, errors.As(err, &applyErr))
+		require.Equal(t, "first: string a: nope\nsecond: string a: also nope", applyErr.Deltas())
+	})
+
+	t.Run("retries retryable failures with backoff", func(t *testing.T) {
+		var events []string
+
+		provider := &fakeProvider{
+			name:   "first",
+			actual: []string{"a"},
+			applyErrs: []error{
+				governance.Retryable(errors.New("rate limited")),
+				governance.Retryable(errors.New("bad gateway")),
+			},
+			events: &events,
+		}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{provider},
+			Retries:   2,
+			Backoff:   time.Millisecond,
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.NoError(t, err)
+		require.Equal(t, []string{"first: load", "first: apply b", "first: apply b", "first: apply b"}, events)
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		var events []string
+
+		provider := &fakeProvider{
+			name:     "first",
+			actual:   []string{"a"},
+			applyErr: governance.Retryable(errors.New("rate limited")),
+			events:   &events,
+		}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{provider},
+			Retries:   1,
+			Backoff:   time.Millisecond,
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.EqualError(t, err, "first: apply string: rate limited")
+		require.Equal(t, []string{"first: load", "first: apply b", "first: apply b"}, events)
+	})
+
+	t.Run("does not retry permanent failures", func(t *testing.T) {
+		var events []string
+
+		provider := &fakeProvider{
+			name:     "first",
+			actual:   []string{"a"},
+			applyErr: errors.New("unknown member"),
+			events:   &events,
+		}
+
+		runner := governance.Runner{
+			Providers: []governance.Provider{provider},
+			Retries:   3,
+			Backoff:   time.Millisecond,
+		}
+
+		err := runner.Run(context.Background(), config)
+		require.EqualError(t, err, "first: apply string: unknown member")
+		require.Equal(t, []string{"first: load", "first: apply b"}, events)
+	})
+
+	t.Run("applies independent deltas concurrently", func(t *testing.T) {
+		provider := &keyedProvider{}
+
+		runner := governance.Runner{
+			Concurrency: 2,
+		}
+
+		err := runner.Apply(context.Background(), []governance.ProviderPlan{
+			{
+				Provider: provider,
+				Deltas: []governance.ProviderDelta{
+					keyedDelta{"alice", "1"},
+					keyedDelta{"bob", "1"},
+					keyedDelta{"alice", "2"},
+					keyedDelta{"bob", "2"},
+					"barrier",
+					keyedDelta{"alice", "3"},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, provider.maxInFlight)
+		require.Equal(t, []string{"bob 1", "bob 2", "barrier"}, provider.applied["bob"])
+		require.Equal(t, []string{"alice 1", "alice 2", "barrier", "alice 3"}, provider.applied["alice"])
+	})
+
+	t.Run("only skips the failed key's later deltas", func(t *testing.T) {
+		provider := &keyedProvider{failKey: "alice"}
+
+		runner := governance.Runner{
+			Concurrency: 1,
+		}
+
+		err := runner.Apply(context.Background(), []governance.ProviderPlan{
+			{
+				Provider: provider,
+				Deltas: []governance.ProviderDelta{
+					keyedDelta{"alice", "1"},
+					keyedDelta{"alice", "2"},
+					keyedDelta{"bob", "1"},
+					keyedDelta{"bob", "2"},
+				},
+			},
+		})
+		require.EqualError(t, err, "keyed: apply governance_test.keyedDelta: nope")
+		require.Equal(t, map[string][]string{
+			"alice": {"alice 1"},
+			"bob":   {"bob 1", "bob 2"},
+		}, provider.applied)
+	})
+
+	t.Run("stops applying once the context is done", func(t *testing.T) {
+		var events []string
+
+		provider := &fakeProvider{name: "first", actual: []string{}, events: &events}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := governance.Runner{}.Apply(ctx, []governance.ProviderPlan{
+			{Provider: provider, Deltas: []governance.ProviderDelta{"a", "b"}},
+		})
+		require.Equal(t, context.Canceled, err)
+		require.Empty(t, events)
+	})
+
+	t.Run("only skips deltas depending on a failed delta", func(t *testing.T) {
+		provider := &dependentProvider{fail: "create core"}
+
+		err := governance.Runner{}.Apply(context.Background(), []governance.ProviderPlan{
+			{
+				Provider: provider,
+				Deltas: []governance.ProviderDelta{
+					dependentDelta{name: "create core", provides: []string{"role:core"}},
+					dependentDelta{name: "create k8s", provides: []string{"role:k8s"}},
+					dependentDelta{name: "positions", dependsOn: []string{"role:core", "role:k8s"}},
+					dependentDelta{name: "grant k8s", dependsOn: []string{"role:k8s"}},
+					dependentDelta{name: "grant core", dependsOn: []string{"role:core"}},
+					dependentDelta{name: "nickname"},
+				},
+			},
+		})
+		require.EqualError(t, err, "dependent: apply governance_test.dependentDelta: nope")
+		require.Equal(t, []string{"create core", "create k8s", "grant k8s", "nickname"}, provider.applied)
+	})
+}
+
+type dependentDelta struct {
+	name      string
+	provides  []string
+	dependsOn []string
+}
+
+func (delta dependentDelta) Provides() []string  { return delta.provides }
+func (delta dependentDelta) DependsOn() []string { return delta.dependsOn }
+
+// dependentProvider only applies deltas, recording their names in order.
+type dependentProvider struct {
+	fail    string
+	applied []string
+}
+
+func (provider *dependentProvider) Name() string { return "dependent" }
+
+func (provider *dependentProvider) Load(context.Context) (governance.ProviderState, error) {
+	return nil, nil
+}
+
+func (provider *dependentProvider) Desired(*governance.Config) (governance.ProviderState, error) {
+	return nil, nil
+}
+
+func (provider *dependentProvider) Diff(_, _ governance.ProviderState) ([]governance.ProviderDelta, error) {
+	return nil, nil
+}
+
+func (provider *dependentProvider) Apply(_ context.Context, _ *zap.Logger, delta governance.ProviderDelta) error {
+	name := delta.(dependentDelta).name
+	provider.applied = append(provider.applied, name)
+
+	if name == provider.fail {
+		return errors.New("nope")
+	}
+
+	return nil
+}
+
+type keyedDelta struct {
+	key  string
+	name string
+}
+
+func (delta keyedDelta) ConcurrencyKey() string { return delta.key }
+
+// keyedProvider only applies deltas; it records them by key, with other
+// deltas recorded under every key seen so far.
+type keyedProvider struct {
+	failKey string
+
+	lock        sync.Mutex
+	inFlight    int
+	maxInFlight int
+	applied     map[string][]string
+}
+
+func (provider *keyedProvider) Name() string { return "keyed" }
+
+func (provider *keyedProvider) Load(context.Context) (governance.ProviderState, error) {
+	return nil, nil
+}
+
+func (provider *keyedProvider) Desired(*governance.Config) (governance.ProviderState, error) {
+	return nil, nil
+}
+
+func (provider *keyedProvider) Diff(_, _ governance.ProviderState) ([]governance.ProviderDelta, error) {
+	return nil, nil
+}
+
+func (provider *keyedProvider) Apply(_ context.Context, _ *zap.Logger, delta governance.ProviderDelta) error {
+	provider.lock.Lock()
+	provider.inFlight++
+	if provider.inFlight > provider.maxInFlight {
+		provider.maxInFlight = provider.inFlight
+	}
+	provider.lock.Unlock()
+
+	// give the other worker a chance to start
+	time.Sleep(10 * time.Millisecond)
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.inFlight--
+
+	if provider.applied == nil {
+		provider.applied = map[string][]string{}
+	}
+
+	keyed, ok := delta.(keyedDelta)
+	if !ok {
+		for key := range provider.applied {
+			provider.applied[key] = append(provider.applied[key], delta.(string))
+		}
+
+		return nil
+	}
+
+	provider.applied[keyed.key] = append(provider.applied[keyed.key], keyed.key+" "+keyed.name)
+
+	if keyed.key == provider.failKey {
+		return errors.New("nope")
+	}
+
+	return nil
+}
+
+// fakeProvider syncs the set of team names; deltas are names to add.
+type fakeProvider struct {
+	name   string
+	actual []string
+
+	loadErr  error
+	applyErr error
+
+	// applyErrs are returned by the first applies, before applyErr
+	applyErrs []error
+
+	events *[]string
+}
+
+func (provider *fakeProvider) Name() string { return provider.name }
+
+func (provider *fakeProvider) Load(context.Context) (governance.ProviderState, error) {
+	*provider.events = append(*provider.events, provider.name+": load")
+	return provider.actual, provider.loadErr
+}
+
+func (provider *fakeProvider) Desired(config *governance.Config) (governance.ProviderState, error) {
+	var names []string
+	for name := range config.Teams {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (provider *fakeProvider) Diff(desired, actual governance.ProviderState) ([]governance.ProviderDelta, error) {
+	have := map[string]bool{}
+	for _, name := range actual.([]string) {
+		have[name] = true
+	}
+
+	var deltas []governance.ProviderDelta
+	for _, name := range desired.([]string) {
+		if !have[name] {
+			deltas = append(deltas, name)
+		}
+	}
+
+	return deltas, nil
+}
+
+func (provider *fakeProvider) Apply(_ context.Context, _ *zap.Logger, delta governance.ProviderDelta) error {
+	*provider.events = append(*provider.events, provider.name+": apply "+delta.(string))
+
+	if len(provider.applyErrs) > 0 {
+		err := provider.applyErrs[0]
+		provider.applyErrs = provider.applyErrs[1:]
+		return err
+	}
+
+	return provider.applyErr
+}
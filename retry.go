@@ -0,0 +1,70 @@
+package governance
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RetryableError marks a failure as transient, e.g. a rate limit or a server
+// error, so that the delta is tried again. Any other error is permanent.
+type RetryableError struct {
+	Err error
+}
+
+// Retryable marks err as transient.
+func Retryable(err error) error {
+	return RetryableError{Err: err}
+}
+
+// IsRetryable reports whether err was marked as transient.
+func IsRetryable(err error) bool {
+	return errors.As(err, &RetryableError{})
+}
+
+func (err RetryableError) Error() string {
+	return err.Err.Error()
+}
+
+func (err RetryableError) Unwrap() error {
+	return err.Err
+}
+
+// DeltaFailure is a delta which could not be applied.
+type DeltaFailure struct {
+	Provider string
+	Delta    ProviderDelta
+	Err      error
+}
+
+func (failure DeltaFailure) Error() string {
+	return fmt.Sprintf("%s: apply %T: %s", failure.Provider, failure.Delta, failure.Err)
+}
+
+func (failure DeltaFailure) Unwrap() error {
+	return failure.Err
+}
+
+// ApplyError is returned when any delta fails to apply, once everything
+// that could be applied has been.
+type ApplyError struct {
+	Failures []DeltaFailure
+}
+
+func (err ApplyError) Error() string {
+	if len(err.Failures) == 1 {
+		return err.Failures[0].Error()
+	}
+
+	return fmt.Sprintf("%d deltas failed to apply", len(err.Failures))
+}
+
+// Deltas describes each failed delta and why on its own line.
+func (err ApplyError) Deltas() string {
+	lines := make([]string, len(err.Failures))
+	for i, failure := range err.Failures {
+		lines[i] = fmt.Sprintf("%s: %T %+v: %s", failure.Provider, failure.Delta, failure.Delta, failure.Err)
+	}
+
+	return strings.Join(lines, "\n")
+}
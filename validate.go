@@ -0,0 +1,271 @@
+package governance
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// textChannelName matches the names Discord keeps as-is for text channels.
+var textChannelName = regexp.MustCompile(`^[a-z0-9_-]{1,100}$`)
+
+// ConfigError describes a problem with a single file in the governance tree.
+// Line and Column are set when the problem can be traced to a position in the
+// YAML source.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (err ConfigError) Error() string {
+	location := err.File
+	if err.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", err.File, err.Line, err.Column)
+	}
+
+	if err.Field == "" {
+		return fmt.Sprintf("%s: %s", location, err.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, err.Field, err.Message)
+}
+
+// ConfigErrors is returned by LoadConfig when one or more files fail to
+// decode.
+type ConfigErrors []error
+
+func (errs ConfigErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Validate cross-references the loaded configuration, returning every
+// problem found rather than stopping at the first one.
+func (cfg *Config) Validate() []error {
+	var errs []error
+
+	report := func(file, field, msg string, args ...interface{}) {
+		errs = append(errs, ConfigError{
+			File:    file,
+			Field:   field,
+			Message: fmt.Sprintf(msg, args...),
+		})
+	}
+
+	repoNames := map[string]bool{}
+	for _, key := range sortedRepos(cfg.Repos) {
+		repo := cfg.Repos[key]
+		fn := "repos/" + key + ".yml"
+
+		if repo.Name == "" {
+			report(fn, "name", "must not be empty")
+		} else if repo.Name != key {
+			report(fn, "name", "%q does not match file name", repo.Name)
+		}
+
+		repoNames[repo.Name] = true
+	}
+
+	logins := map[string]string{}
+	for _, key := range sortedContributors(cfg.Contributors) {
+		person := cfg.Contributors[key]
+		fn := "contributors/" + key + ".yml"
+
+		if person.GitHub == "" {
+			report(fn, "github", "must not be empty")
+		} else {
+			if person.GitHub != key {
+				report(fn, "github", "%q does not match file name", person.GitHub)
+			}
+
+			login := strings.ToLower(person.GitHub)
+			if other, found := logins[login]; found {
+				report(fn, "github", "%q is already used by contributors/%s.yml", person.GitHub, other)
+			} else {
+				logins[login] = key
+			}
+		}
+
+		for _, repo := range sortedRepoPermissions(person.Repos) {
+			if !repoNames[repo] {
+				report(fn, "repos", "unknown repo %q", repo)
+			}
+
+			if permission3to4(person.Repos[repo]) == "INVALID" {
+				report(fn, "repos", "invalid permission %q for repo %q", person.Repos[repo], repo)
+			}
+		}
+	}
+
+	// without an owner, applying github.tf would demote every current owner
+	var owners int
+	for _, person := range cfg.Contributors {
+		if person.Owner {
+			owners++
+		}
+	}
+
+	if owners == 0 {
+		report("contributors", "owner", "no contributor is an organization owner")
+	}
+
+	roleIDs := map[string]string{}
+	for _, key := range sortedTeams(cfg.Teams) {
+		team := cfg.Teams[key]
+		fn := "teams/" + key + ".yml"
+
+		if team.Name == "" {
+			report(fn, "name", "must not be empty")
+		}
+
+		if strings.TrimSpace(team.Purpose) == "" {
+			report(fn, "purpose", "must not be empty")
+		}
+
+		if team.AllContributors && len(team.RawMembers) > 0 {
+			report(fn, "members", "must not be set along with all_contributors")
+		}
+
+		seen := map[string]bool{}
+		for _, member := range team.RawMembers {
+			if seen[member] {
+				report(fn, "members", "%q is listed more than once", member)
+				continue
+			}
+
+			seen[member] = true
+
+			if _, found := cfg.Contributors[member]; !found {
+				report(fn, "members", "unknown contributor %q", member)
+			}
+		}
+
+		members := team.Members(cfg)
+		for _, maintainer := range team.RawMaintainers {
+			if _, found := members[maintainer]; !found {
+				report(fn, "maintainers", "%q is not a member of the team", maintainer)
+			}
+		}
+
+		if team.RawRepoPermission != "" && team.RepoPermission() == "INVALID" {
+			report(fn, "repo_permission", "invalid permission %q", team.RawRepoPermission)
+		}
+
+		for _, repo := range team.Repos {
+			if !repoNames[repo] {
+				report(fn, "repos", "unknown repo %q", repo)
+			}
+		}
+
+		_, err := team.Discord.AddedPermissions.Permissions()
+		if err != nil {
+			report(fn, "discord.added_permissions", "%s", err)
+		}
+
+		channelNames := map[string]bool{}
+		for _, channel := range team.Discord.Channels {
+			switch channel.ChannelType() {
+			case DiscordChannelText:
+				if !textChannelName.MatchString(channel.Name) {
+					report(fn, "discord.channels", "invalid text channel name %q", channel.Name)
+				}
+			case DiscordChannelVoice:
+				if channel.Name == "" {
+					report(fn, "discord.channels", "missing channel name")
+				}
+
+				if channel.Topic != "" {
+					report(fn, "discord.channels", "voice channel %q cannot have a topic", channel.Name)
+				}
+			default:
+				report(fn, "discord.channels", "invalid type %q for channel %q", channel.Type, channel.Name)
+			}
+
+			if channelNames[channel.Name] {
+				report(fn, "discord.channels", "%q is listed more than once", channel.Name)
+			}
+
+			channelNames[channel.Name] = true
+		}
+
+		if team.Discord.RoleID != "" {
+			if other, found := roleIDs[team.Discord.RoleID]; found {
+				report(fn, "discord.role_id", "%q is already used by teams/%s.yml", team.Discord.RoleID, other)
+			} else {
+				roleIDs[team.Discord.RoleID] = key
+			}
+		}
+	}
+
+	retiredIDs := map[string]bool{}
+	for _, role := range cfg.RetiredRoles {
+		if role.ID == "" {
+			report(retiredRolesFile, "id", "must not be empty")
+			continue
+		}
+
+		if team, found := roleIDs[role.ID]; found {
+			report(retiredRolesFile, "id", "%q is still used by teams/%s.yml", role.ID, team)
+		}
+
+		if retiredIDs[role.ID] {
+			report(retiredRolesFile, "id", "%q is listed more than once", role.ID)
+		}
+
+		retiredIDs[role.ID] = true
+	}
+
+	return errs
+}
+
+func sortedRepos(repos map[string]Repo) []string {
+	var keys []string
+	for k := range repos {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedContributors(contributors map[string]Person) []string {
+	var keys []string
+	for k := range contributors {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedTeams(teams map[string]Team) []string {
+	var keys []string
+	for k := range teams {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedRepoPermissions(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}